@@ -0,0 +1,305 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminHandler serves the admin API used by `ydb cli`:
+//
+//	GET  /rooms?prefix=&cursor=&limit=  list persisted rooms
+//	GET  /rooms/{room}/log              raw room log
+//	GET  /rooms/{room}/journal          journal entries as JSON, ?since=&until= in RFC 3339
+//	GET  /rooms/{room}/audit            audit chain as JSON, the log offset it covers as Ydb-Offset
+//	PUT  /rooms/{room}/content          replace the room with a Yjs update
+//	POST /rooms/{room}/update           append a Yjs update
+//	POST /rooms/{room}/create           create the room with a Yjs update, 409 if it has content
+//	POST /rooms/{room}/copy             create the room from room ?from=, forked at ?offset= if given
+//
+// Room names are path escaped. The API is unauthenticated; mount it behind
+// your own authentication or on a trusted listener only.
+func (ydb *Ydb) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rooms", ydb.adminListRooms)
+	mux.HandleFunc("GET /rooms/{room}/log", func(w http.ResponseWriter, r *http.Request) {
+		room, err := adminRoomName(r)
+		var data []byte
+		if err == nil {
+			data, err = ydb.RoomLog(room)
+		}
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})
+	mux.HandleFunc("GET /rooms/{room}/journal", ydb.adminJournal)
+	mux.HandleFunc("GET /rooms/{room}/audit", func(w http.ResponseWriter, r *http.Request) {
+		room, err := adminRoomName(r)
+		var records []AuditRecord
+		var offset uint32
+		if err == nil {
+			records, offset, err = ydb.AuditRecords(room)
+		}
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		if records == nil {
+			records = []AuditRecord{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(offsetHeader, strconv.FormatUint(uint64(offset), 10))
+		json.NewEncoder(w).Encode(records)
+	})
+	mux.HandleFunc("PUT /rooms/{room}/content", func(w http.ResponseWriter, r *http.Request) {
+		ydb.adminWrite(w, r, ydb.ReplaceRoomContent)
+	})
+	mux.HandleFunc("POST /rooms/{room}/update", func(w http.ResponseWriter, r *http.Request) {
+		ydb.adminWrite(w, r, ydb.AppendUpdate)
+	})
+	mux.HandleFunc("POST /rooms/{room}/create", func(w http.ResponseWriter, r *http.Request) {
+		ydb.adminWrite(w, r, ydb.CreateRoom)
+	})
+	mux.HandleFunc("POST /rooms/{room}/copy", ydb.adminCopy)
+	return mux
+}
+
+type adminRoom struct {
+	Name    YjsRoomName `json:"name"`
+	Size    uint32      `json:"size"`
+	ModTime time.Time   `json:"mod_time"`
+}
+
+type adminRoomList struct {
+	Rooms      []adminRoom `json:"rooms"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func (ydb *Ydb) adminListRooms(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	rooms, next, err := ydb.ListRooms(q.Get("prefix"), q.Get("cursor"), limit)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	list := adminRoomList{Rooms: make([]adminRoom, 0, len(rooms)), NextCursor: next}
+	for _, rs := range rooms {
+		list.Rooms = append(list.Rooms, adminRoom{Name: rs.Name, Size: rs.Size, ModTime: rs.ModTime})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (ydb *Ydb) adminJournal(w http.ResponseWriter, r *http.Request) {
+	var times [2]time.Time
+	for i, param := range []string{"since", "until"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			var err error
+			if times[i], err = time.Parse(time.RFC3339Nano, v); err != nil {
+				http.Error(w, "invalid "+param, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	room, err := adminRoomName(r)
+	var entries []JournalEntry
+	if err == nil {
+		entries, err = ydb.Journal(room, times[0], times[1])
+	}
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []JournalEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (ydb *Ydb) adminWrite(w http.ResponseWriter, r *http.Request, write func(YjsRoomName, []byte) error) {
+	body := io.Reader(r.Body)
+	if maxSize := ydb.config().MaxMessageSize; maxSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	update, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	room, err := adminRoomName(r)
+	if err == nil {
+		err = write(room, update)
+	}
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ydb *Ydb) adminCopy(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	src := YjsRoomName(q.Get("from"))
+	dst, err := adminRoomName(r)
+	if err == nil {
+		err = validateRoomName(src)
+	}
+	if err == nil {
+		if offset := q.Get("offset"); offset != "" {
+			var n uint64
+			if n, err = strconv.ParseUint(offset, 10, 32); err != nil {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+			err = ydb.CreateRoomAt(src, dst, uint32(n))
+		} else {
+			err = ydb.CreateRoomFrom(src, dst)
+		}
+	}
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminRoomName(r *http.Request) (YjsRoomName, error) {
+	room := YjsRoomName(r.PathValue("room"))
+	return room, validateRoomName(room)
+}
+
+// writeHTTPError responds with the status code matching err.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	var rejected *UpdateRejectedError
+	var httpErr *HTTPError
+	switch {
+	case errors.Is(err, ErrRoomNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotSupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, ErrRoomTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrRoomExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalidOffset):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &httpErr):
+		http.Error(w, err.Error(), httpErr.Status)
+	case errors.As(err, &rejected):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrInvalidUpdate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// adminClient talks to the AdminHandler of a remote Ydb instance.
+type adminClient struct {
+	client *http.Client
+	base   string
+}
+
+// newAdminClient turns the --addr operand into a client for the admin API,
+// which `ydb start --admin` mounts under /admin.
+func newAdminClient(addr string) *adminClient {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if !strings.HasSuffix(addr, "/admin") {
+		addr += "/admin"
+	}
+	return &adminClient{client: &http.Client{Timeout: 30 * time.Second}, base: addr}
+}
+
+func (c *adminClient) roomURL(room YjsRoomName, action string) string {
+	return c.base + "/rooms/" + url.PathEscape(string(room)) + "/" + action
+}
+
+func (c *adminClient) do(method, url string, body []byte) ([]byte, error) {
+	data, _, err := c.doWithHeader(method, url, body)
+	return data, err
+}
+
+// doWithHeader is do, also returning the response header.
+func (c *adminClient) doWithHeader(method, url string, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, resp.Header, nil
+}
+
+func (c *adminClient) RoomLog(room YjsRoomName) ([]byte, error) {
+	return c.do(http.MethodGet, c.roomURL(room, "log"), nil)
+}
+
+func (c *adminClient) AuditRecords(room YjsRoomName) ([]AuditRecord, uint32, error) {
+	data, header, err := c.doWithHeader(http.MethodGet, c.roomURL(room, "audit"), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := strconv.ParseUint(header.Get(offsetHeader), 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid %s header: %w", offsetHeader, err)
+	}
+	var records []AuditRecord
+	return records, uint32(offset), json.Unmarshal(data, &records)
+}
+
+func (c *adminClient) ReplaceRoomContent(room YjsRoomName, update []byte) error {
+	_, err := c.do(http.MethodPut, c.roomURL(room, "content"), update)
+	return err
+}
+
+func (c *adminClient) AppendUpdate(room YjsRoomName, update []byte) error {
+	_, err := c.do(http.MethodPost, c.roomURL(room, "update"), update)
+	return err
+}
+
+func (c *adminClient) CreateRoom(room YjsRoomName, update []byte) error {
+	_, err := c.do(http.MethodPost, c.roomURL(room, "create"), update)
+	return err
+}
+
+func (c *adminClient) CreateRoomFrom(src, dst YjsRoomName) error {
+	_, err := c.do(http.MethodPost, c.roomURL(dst, "copy")+"?from="+url.QueryEscape(string(src)), nil)
+	return err
+}
+
+func (c *adminClient) CreateRoomAt(src, dst YjsRoomName, offset uint32) error {
+	_, err := c.do(http.MethodPost, c.roomURL(dst, "copy")+"?from="+url.QueryEscape(string(src))+"&offset="+strconv.FormatUint(uint64(offset), 10), nil)
+	return err
+}
@@ -0,0 +1,149 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newAdminTestServer(t *testing.T) (*Ydb, *adminClient) {
+	t.Helper()
+	ydbInstance := InitYdb(NewDiskStore(t.TempDir()), NewLocalBroadcaster(64), DefaultConfig())
+	t.Cleanup(ydbInstance.Close)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", ydbInstance.AdminHandler()))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return ydbInstance, newAdminClient(server.URL)
+}
+
+func TestAdminAppendAndDecode(t *testing.T) {
+	_, client := newAdminTestServer(t)
+	room := YjsRoomName("a b&c")
+
+	if err := client.AppendUpdate(room, testUpdate([]testItem{{client: 1, root: "text", text: "abc"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AppendUpdate(room, testUpdate([]testItem{{client: 1, clock: 3, origin: &yID{1, 2}, text: "d"}})); err != nil {
+		t.Fatal(err)
+	}
+	data, err := client.RoomLog(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := decodeRoomLog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != "update" || entries[0].Offset != 0 || entries[1].Offset == 0 {
+		t.Fatalf("unexpected log entries: %+v", entries)
+	}
+
+	out := &bytes.Buffer{}
+	if err := printRoomLog(out, data); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 {
+		t.Fatalf("unexpected decode output:\n%s", out)
+	}
+
+	merged, err := mergeRoomLog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testText(applyAll(t, merged), "text"); got != "abcd" {
+		t.Fatalf("exported text = %q, want abcd", got)
+	}
+}
+
+func TestAdminRejectsInvalidUpdate(t *testing.T) {
+	_, client := newAdminTestServer(t)
+	err := client.AppendUpdate("room", []byte{1, 2, 3})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected 400 Bad Request, got %v", err)
+	}
+}
+
+func TestAdminReplaceContentResetsSessions(t *testing.T) {
+	ydbInstance, client := newAdminTestServer(t)
+	ydbInstance.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "old"}}))
+
+	s := ydbInstance.createSession("room")
+	mc := &mockConn{}
+	s.setConn(mc)
+	ydbInstance.subscribeRoom(s, 0)
+
+	if err := client.ReplaceRoomContent("room", testUpdate([]testItem{{client: 2, root: "text", text: "new"}})); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, calls := mc.getClose(); calls != 1 || code != CloseRoomReset {
+		t.Fatalf("expected session closed with %d, got code %d (%d calls)", CloseRoomReset, code, calls)
+	}
+	update, err := ydbInstance.RoomUpdate("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testText(applyAll(t, update), "text"); got != "new" {
+		t.Fatalf("text = %q, want new", got)
+	}
+
+	cfg := DefaultConfig()
+	cfg.MaxRoomSize, cfg.MaxMessageSize = 64, 64
+	ydbInstance.UpdateConfig(cfg)
+	large := testUpdate([]testItem{{client: 3, root: "text", text: strings.Repeat("x", 100)}})
+	if err := ydbInstance.ReplaceRoomContent("room", large); !errors.Is(err, ErrRoomTooLarge) {
+		t.Fatalf("expected ErrRoomTooLarge, got %v", err)
+	}
+}
+
+func TestAdminListRooms(t *testing.T) {
+	ydbInstance, client := newAdminTestServer(t)
+	for _, name := range []YjsRoomName{"a", "b", "c"} {
+		ydbInstance.AppendUpdate(name, testUpdate([]testItem{{client: 1, root: "text", text: "x"}}))
+	}
+	data, err := client.do(http.MethodGet, client.base+"/rooms?limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list adminRoomList
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rooms) != 2 || list.Rooms[0].Name != "a" || list.NextCursor != "b" {
+		t.Fatalf("unexpected listing: %+v", list)
+	}
+}
+
+func TestCliCommandsAgainstDir(t *testing.T) {
+	ydbInstance := InitYdb(NewDiskStore(t.TempDir()), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	dir := t.TempDir()
+
+	in := filepath.Join(dir, "in.bin")
+	os.WriteFile(in, testUpdate([]testItem{{client: 1, root: "text", text: "hi"}}), 0600)
+	if err := runCliCommand(ydbInstance, "import", "room", in, cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(in, testUpdate([]testItem{{client: 1, clock: 2, origin: &yID{1, 1}, text: "!"}}), 0600)
+	if err := runCliCommand(ydbInstance, "append", "room", in, cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.bin")
+	if err := runCliCommand(ydbInstance, "export", "room", out, cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := os.ReadFile(out)
+	if got := testText(applyAll(t, exported), "text"); got != "hi!" {
+		t.Fatalf("exported text = %q, want hi!", got)
+	}
+	if err := runCliCommand(ydbInstance, "frobnicate", "room", out, cliOptions{}); err == nil {
+		t.Fatal("expected an error for an unknown command")
+	}
+}
@@ -0,0 +1,243 @@
+package ydb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditError reports the first broken link of an audit chain.
+type AuditError struct {
+	Room   YjsRoomName
+	Record int    // index of the offending record; len(records) for data written after the last one
+	Offset uint32 // offset of the room log where the chain breaks
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit chain of room %s broken at record %d (offset %d): %s", e.Room, e.Record, e.Offset, e.Reason)
+}
+
+// writeLockStripes is the number of write locks rooms share.
+const writeLockStripes = 256
+
+// writeLock returns the mutex that serializes writes to a room log with the
+// records written about them. Rooms share a fixed set of mutexes, so that
+// there is nothing to clean up when a room goes away; a holder must not take
+// the write lock of another room, except through lockRoomPair.
+func (ydb *Ydb) writeLock(name YjsRoomName) *sync.Mutex {
+	return &ydb.writeLocks[writeLockIndex(name)]
+}
+
+func writeLockIndex(name YjsRoomName) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32() % writeLockStripes
+}
+
+// lockRoomPair takes the write locks of two rooms in index order, so that it
+// can't deadlock with another pair, and returns the function releasing them.
+func (ydb *Ydb) lockRoomPair(a, b YjsRoomName) (unlock func()) {
+	i, j := writeLockIndex(a), writeLockIndex(b)
+	if i > j {
+		i, j = j, i
+	}
+	ydb.writeLocks[i].Lock()
+	if i != j {
+		ydb.writeLocks[j].Lock()
+	}
+	return func() {
+		if i != j {
+			ydb.writeLocks[j].Unlock()
+		}
+		ydb.writeLocks[i].Unlock()
+	}
+}
+
+// auditUpdate links data, appended to a room ending at offset, to the audit
+// chain. A room without records first gets a reset record for the data
+// written before. Must be called with the write lock held.
+func (ydb *Ydb) auditUpdate(name YjsRoomName, data []byte, offset uint32) error {
+	as, ok := ydb.store.(AuditStore)
+	if !ok || !ydb.config().Audit {
+		return nil
+	}
+	last, ok, err := as.LastAudit(name)
+	if err != nil {
+		return err
+	}
+	start := offset - uint32(len(data))
+	if !ok && start > 0 {
+		log, _, err := ydb.store.ReadFrom(name, 0)
+		if err != nil {
+			return err
+		}
+		if uint32(len(log)) < start {
+			return fmt.Errorf("room log is shorter than offset %d", start)
+		}
+		if last, err = ydb.appendAudit(as, name, "", 0, log[:start], true); err != nil {
+			return err
+		}
+	}
+	_, err = ydb.appendAudit(as, name, last.Hash, start, data, false)
+	return err
+}
+
+// auditReset starts the audit chain of a room over after its log was replaced
+// by data. Must be called with the write lock held.
+func (ydb *Ydb) auditReset(name YjsRoomName, data []byte) error {
+	as, ok := ydb.store.(AuditStore)
+	if !ok || !ydb.config().Audit {
+		return nil
+	}
+	last, _, err := as.LastAudit(name)
+	if err != nil {
+		return err
+	}
+	_, err = ydb.appendAudit(as, name, last.Hash, 0, data, true)
+	return err
+}
+
+func (ydb *Ydb) appendAudit(as AuditStore, name YjsRoomName, prev string, offset uint32, data []byte, reset bool) (AuditRecord, error) {
+	digest := sha256.Sum256(data)
+	rec := AuditRecord{
+		Offset:    offset,
+		EndOffset: offset + uint32(len(data)),
+		Time:      time.Now().UTC(),
+		Reset:     reset,
+		Digest:    hex.EncodeToString(digest[:]),
+		Prev:      prev,
+	}
+	rec.Hash = auditHash(rec, ydb.config().AuditKey)
+	return rec, as.AppendAudit(name, rec)
+}
+
+// auditHash hashes every field of rec but Hash, with HMAC-SHA256 if key is set.
+func auditHash(rec AuditRecord, key []byte) string {
+	h := sha256.New()
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	}
+	for _, field := range []string{
+		rec.Prev,
+		strconv.FormatUint(uint64(rec.Offset), 10),
+		strconv.FormatUint(uint64(rec.EndOffset), 10),
+		strconv.FormatInt(rec.Time.UnixNano(), 10),
+		strconv.FormatBool(rec.Reset),
+		rec.Digest,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditRecords returns the audit chain of a room together with the offset of
+// the end of its log when the records were read, which is where verifying
+// a log read later has to stop. The store must implement AuditStore.
+func (ydb *Ydb) AuditRecords(name YjsRoomName) ([]AuditRecord, uint32, error) {
+	as, ok := ydb.store.(AuditStore)
+	if !ok {
+		return nil, 0, ErrNotSupported
+	}
+	writeLock := ydb.writeLock(name)
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	records, err := as.AuditRecords(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := ydb.store.Size(name)
+	return records, offset, err
+}
+
+// VerifyAudit checks the audit chain of a room against its log, with
+// Config.AuditKey, and returns the number of records checked. A broken chain
+// is reported as *AuditError.
+func (ydb *Ydb) VerifyAudit(name YjsRoomName) (int, error) {
+	records, err := verifyAudit(ydb, name, ydb.config().AuditKey)
+	return len(records), err
+}
+
+// verifyAudit checks the audit chain of a room of backend, a Ydb or an admin
+// API client, and returns its records.
+func verifyAudit(backend roomBackend, name YjsRoomName, key []byte) ([]AuditRecord, error) {
+	records, offset, err := backend.AuditRecords(name)
+	if err != nil {
+		return nil, err
+	}
+	log, err := backend.RoomLog(name)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(log)) > offset {
+		log = log[:offset]
+	}
+	return records, verifyAuditChain(name, records, log, key)
+}
+
+// verifyAuditChain checks that every record links to the previous one and
+// hashes to its Hash, that every reset but the first replaced the log with a
+// single update, as ReplaceRoomContent does, and that the records since the
+// last reset cover log without gaps and with matching digests.
+//
+// Without a key anyone able to write the chain can recompute the hashes, so
+// only edits that leave the rest of the chain alone are detected.
+func verifyAuditChain(name YjsRoomName, records []AuditRecord, log []byte, key []byte) error {
+	broken := func(i int, offset uint32, format string, args ...any) error {
+		return &AuditError{Room: name, Record: i, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+	}
+	current := 0
+	for i, rec := range records {
+		prev := ""
+		if i > 0 {
+			prev = records[i-1].Hash
+		}
+		if rec.Prev != prev {
+			return broken(i, rec.Offset, "does not link to the previous record")
+		}
+		if auditHash(rec, key) != rec.Hash {
+			return broken(i, rec.Offset, "record was modified")
+		}
+		if rec.Reset {
+			current = i
+		}
+	}
+	if current > 0 {
+		rec := records[current]
+		if int(rec.EndOffset) > len(log) {
+			return broken(current, rec.Offset, "log ends at offset %d", len(log))
+		}
+		entries, err := decodeRoomLog(log[:rec.EndOffset])
+		if err != nil || len(entries) != 1 {
+			return broken(current, rec.Offset, "reset does not cover a single update")
+		}
+		if syncType, _, err := decodeSyncMessage(entries[0].Message); err != nil || syncType != messageYjsUpdate {
+			return broken(current, rec.Offset, "reset does not cover a single update")
+		}
+	}
+	var offset uint32
+	for i := current; i < len(records); i++ {
+		rec := records[i]
+		if rec.Offset != offset || rec.EndOffset < rec.Offset {
+			return broken(i, offset, "records offsets %d to %d, expected offset %d", rec.Offset, rec.EndOffset, offset)
+		}
+		if int(rec.EndOffset) > len(log) {
+			return broken(i, rec.Offset, "log ends at offset %d", len(log))
+		}
+		digest := sha256.Sum256(log[rec.Offset:rec.EndOffset])
+		if hex.EncodeToString(digest[:]) != rec.Digest {
+			return broken(i, rec.Offset, "log data does not match the digest")
+		}
+		offset = rec.EndOffset
+	}
+	if int(offset) != len(log) {
+		return broken(len(records), offset, "%d bytes of the log are not audited", len(log)-int(offset))
+	}
+	return nil
+}
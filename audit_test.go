@@ -0,0 +1,228 @@
+package ydb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditChain(t *testing.T) {
+	dir := t.TempDir()
+	ydbInstance := InitYdb(NewDiskStore(dir), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	update := func(clock uint64) []byte {
+		item := testItem{client: 1, clock: clock, text: "x"}
+		if clock == 0 {
+			item.root = "text"
+		} else {
+			item.origin = &yID{1, clock - 1}
+		}
+		return testUpdate([]testItem{item})
+	}
+
+	// Written before auditing starts, covered by a reset record
+	ydbInstance.AppendUpdate("room", update(0))
+	cfg := DefaultConfig()
+	cfg.Audit = true
+	if err := ydbInstance.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for clock := uint64(1); clock < 4; clock++ {
+		if err := ydbInstance.AppendUpdate("room", update(clock)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := ydbInstance.VerifyAudit("room"); err != nil || n != 4 {
+		t.Fatalf("expected 4 valid records, got %d, %v", n, err)
+	}
+	if err := ydbInstance.ReplaceRoomContent("room", update(0)); err != nil {
+		t.Fatal(err)
+	}
+	ydbInstance.AppendUpdate("room", update(1))
+	records, _, _ := ydbInstance.AuditRecords("room")
+	if len(records) != 6 || !records[4].Reset || records[5].Prev != records[4].Hash {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if _, err := ydbInstance.VerifyAudit("room"); err != nil {
+		t.Fatal(err)
+	}
+
+	roomFile := filepath.Join(dir, "room")
+	original, _ := os.ReadFile(roomFile)
+	tampered := bytes.Clone(original)
+	tampered[len(tampered)-1] ^= 1
+	os.WriteFile(roomFile, tampered, 0600)
+	var auditErr *AuditError
+	if _, err := ydbInstance.VerifyAudit("room"); !errors.As(err, &auditErr) || auditErr.Record != 5 || auditErr.Offset != records[5].Offset {
+		t.Fatalf("expected the last record to break, got %v", err)
+	}
+	os.WriteFile(roomFile, append(bytes.Clone(original), 0), 0600)
+	if _, err := ydbInstance.VerifyAudit("room"); !errors.As(err, &auditErr) || auditErr.Record != 6 {
+		t.Fatalf("expected unaudited data to be reported, got %v", err)
+	}
+	os.WriteFile(roomFile, original, 0600)
+
+	auditFile := filepath.Join(dir, sideDataDir, "audit", "room")
+	chain, _ := os.ReadFile(auditFile)
+	os.WriteFile(auditFile, bytes.Replace(chain, []byte(records[2].Digest), []byte(records[3].Digest), 1), 0600)
+	if _, err := ydbInstance.VerifyAudit("room"); !errors.As(err, &auditErr) || auditErr.Record != 2 {
+		t.Fatalf("expected a modified record to be reported, got %v", err)
+	}
+}
+
+func TestCliVerify(t *testing.T) {
+	ydbInstance, client := newAdminTestServer(t)
+	cfg := DefaultConfig()
+	cfg.Audit = true
+	ydbInstance.UpdateConfig(cfg)
+	if err := client.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "abc"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCliCommand(client, "verify", "room", "-", cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCliCommand(ydbInstance, "verify", "room", "-", cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Data written without auditing
+	cfg.Audit = false
+	ydbInstance.UpdateConfig(cfg)
+	ydbInstance.AppendUpdate("room", testUpdate([]testItem{{client: 2, root: "text", text: "x"}}))
+	var auditErr *AuditError
+	if err := runCliCommand(ydbInstance, "verify", "room", "-", cliOptions{}); !errors.As(err, &auditErr) {
+		t.Fatalf("expected an audit error, got %v", err)
+	}
+}
+
+func TestAuditForgedReset(t *testing.T) {
+	for _, key := range []string{"secret", ""} {
+		dir := t.TempDir()
+		cfg := DefaultConfig()
+		cfg.Audit = true
+		cfg.AuditKey = []byte(key)
+		ydbInstance := InitYdb(NewDiskStore(dir), NewLocalBroadcaster(64), cfg)
+		defer ydbInstance.Close()
+		for clock := uint64(0); clock < 3; clock++ {
+			item := testItem{client: 1, clock: clock, text: "x"}
+			if clock == 0 {
+				item.root = "text"
+			} else {
+				item.origin = &yID{1, clock - 1}
+			}
+			if err := ydbInstance.AppendUpdate("room", testUpdate([]testItem{item})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		records, _, _ := ydbInstance.AuditRecords("room")
+
+		// Drop the second update from the log and take the rest as is
+		roomFile := filepath.Join(dir, "room")
+		log, _ := os.ReadFile(roomFile)
+		forged := append(bytes.Clone(log[:records[1].Offset]), log[records[1].EndOffset:]...)
+		os.WriteFile(roomFile, forged, 0600)
+		digest := sha256.Sum256(forged)
+		rec := AuditRecord{
+			EndOffset: uint32(len(forged)),
+			Time:      time.Now().UTC(),
+			Reset:     true,
+			Digest:    hex.EncodeToString(digest[:]),
+			Prev:      records[len(records)-1].Hash,
+		}
+		rec.Hash = auditHash(rec, nil)
+		if err := ydbInstance.store.(AuditStore).AppendAudit("room", rec); err != nil {
+			t.Fatal(err)
+		}
+		var auditErr *AuditError
+		if _, err := ydbInstance.VerifyAudit("room"); !errors.As(err, &auditErr) || auditErr.Record != len(records) {
+			t.Fatalf("key %q: expected the forged reset to be reported, got %v", key, err)
+		}
+	}
+}
+
+func TestAuditKey(t *testing.T) {
+	ydbInstance, client := newAdminTestServer(t)
+	cfg := DefaultConfig()
+	cfg.Audit = true
+	cfg.AuditKey = []byte("secret")
+	ydbInstance.UpdateConfig(cfg)
+	if err := client.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "abc"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCliCommand(client, "verify", "room", "-", cliOptions{auditKey: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	var auditErr *AuditError
+	for _, key := range [][]byte{nil, []byte("other")} {
+		if err := runCliCommand(client, "verify", "room", "-", cliOptions{auditKey: key}); !errors.As(err, &auditErr) || auditErr.Record != 0 {
+			t.Fatalf("key %q: expected an audit error, got %v", key, err)
+		}
+	}
+}
+
+func TestCliDirAudit(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	os.WriteFile(keyFile, []byte("secret\n"), 0600)
+	configFile := filepath.Join(dir, "ydb.json")
+	os.WriteFile(configFile, []byte(`{"audit": true, "journal": true, "audit_key_file": "`+keyFile+`"}`), 0600)
+	cfg, err := cliDirConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Audit || !cfg.Journal || string(cfg.AuditKey) != "secret" {
+		t.Fatalf("expected the audit settings of the config file, got audit %v, journal %v, key %q", cfg.Audit, cfg.Journal, cfg.AuditKey)
+	}
+
+	data := filepath.Join(dir, "data")
+	audited := InitYdb(NewDiskStore(data), NewLocalBroadcaster(64), cfg)
+	if err := audited.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "a"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAuditedWrite(audited, "append", "room", "-"); err != nil {
+		t.Fatal(err)
+	}
+	audited.Close()
+
+	unaudited := InitYdb(NewDiskStore(data), NewLocalBroadcaster(64), DefaultConfig())
+	defer unaudited.Close()
+	for _, command := range []string{"append", "import", "create"} {
+		if err := checkAuditedWrite(unaudited, command, "room", "-"); err == nil {
+			t.Fatalf("expected %s to be refused", command)
+		}
+	}
+	if err := checkAuditedWrite(unaudited, "copy", "room", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAuditedWrite(unaudited, "export", "room", "-"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordlessStore fails to append audit records.
+type recordlessStore struct {
+	*DiskStore
+}
+
+func (recordlessStore) AppendAudit(YjsRoomName, AuditRecord) error {
+	return errors.New("disk full")
+}
+
+func TestAuditFailureReported(t *testing.T) {
+	store := recordlessStore{NewDiskStore(t.TempDir()).(*DiskStore)}
+	cfg := DefaultConfig()
+	cfg.Audit = true
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+	if err := ydbInstance.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "a"}})); err == nil {
+		t.Fatal("expected the failed audit to be reported")
+	}
+	// The update was written all the same
+	if size, _ := store.Size("room"); size == 0 {
+		t.Fatal("expected the update in the room log")
+	}
+}
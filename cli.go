@@ -1,27 +1,39 @@
 package ydb
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 func cliParseStart(args []string) {
-	startCommand := flag.NewFlagSet("start", flag.ExitOnError)
-	tmp := startCommand.Bool("tmp", false, "Use a temporary directory for persisting data (content is lost when server stops)")
-	dir := startCommand.String("dir", "", "Directory that is used to persist data")
-
+	startCommand, settings, configFile := newStartFlagSet("start", flag.ExitOnError)
 	startCommand.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: ydb start [--dir dir] [--tmp]\n\n")
+		fmt.Fprintf(os.Stderr, "usage: ydb start [--config file] [--dir dir] [--tmp] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Every option can also be set with a YDB_* environment variable (e.g. YDB_MAX_ROOM_SIZE)\n")
+		fmt.Fprintf(os.Stderr, "or in the config file (e.g. max_room_size). Flags override environment variables,\n")
+		fmt.Fprintf(os.Stderr, "which override the config file.\n\n")
 		startCommand.PrintDefaults()
 	}
-	startCommand.Parse(args)
-	flag.Parse()
-	if *tmp && *dir != "" {
-		fmt.Fprintf(os.Stderr, "ydb: must not set --dir \"%s\" when using --tmp \n", *dir)
+	if err := parseStartConfig(startCommand, settings, configFile, args, os.LookupEnv); err != nil {
+		exitBecause("ydb: " + err.Error())
+	}
+	sc := &settings.startConfig
+	if sc.Tmp && sc.Dir != "" {
+		fmt.Fprintf(os.Stderr, "ydb: must not set --dir \"%s\" when using --tmp \n", sc.Dir)
 		os.Exit(1)
 	}
-	if *tmp && *dir == "" {
+	if sc.Tmp && sc.Dir == "" {
 		tmpdir, err := os.MkdirTemp("", "ydb")
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ydb: unable to create temporary directory")
@@ -29,9 +41,9 @@ func cliParseStart(args []string) {
 		}
 		fmt.Fprintln(os.Stderr, "using temporary directory")
 		fmt.Fprintln(os.Stderr, "warning: data will be lost when server stops!")
-		*dir = tmpdir
+		sc.Dir = tmpdir
 	}
-	if *dir == "" {
+	if sc.Dir == "" && sc.Store == "disk" {
 		fmt.Fprintln(os.Stderr, "ydb: missing --dir operand")
 		fmt.Fprintln(os.Stderr, "Try 'ydb start --help' for more information")
 		os.Exit(1)
@@ -42,12 +54,349 @@ func cliParseStart(args []string) {
 		os.Exit(1)
 	}
 
-	cfg := DefaultConfig()
-	store := NewDiskStore(*dir, WithMaxRoomSize(cfg.MaxRoomSize))
-	broadcaster := NewLocalBroadcaster(cfg.BroadcastBuffer)
-	ydbInstance := InitYdb(store, broadcaster, cfg)
+	store, broadcaster, err := newStartBackends(sc)
+	if err != nil {
+		exitBecause("ydb: " + err.Error())
+	}
+	var reloader *tlsReloader
+	if sc.TLSCert != "" || sc.TLSKey != "" || sc.TLSClientCA != "" {
+		if reloader, err = newTLSReloader(sc); err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+	}
+	sc.Config.Logger = newStderrLogger()
+	ydbInstance, err := NewYdb(store, broadcaster, sc.Config)
+	if err != nil {
+		exitBecause("ydb: " + err.Error())
+	}
 	defer ydbInstance.Close()
-	setupWebsocketsListener(":8899", ydbInstance)
+	ydbInstance.SetLogLevel(sc.LogLevel)
+	go reloadOnHangup(args, ydbInstance, reloader)
+	setupWebsocketsListener(sc, ydbInstance, reloader)
+}
+
+// reloadOnHangup re-reads the configuration from the same flags, environment
+// and config file, and the TLS certificates, whenever the process receives
+// SIGHUP. Settings outside of Config (listen address, path prefix, store, ...)
+// need a restart; the log level and the TLS files are reloaded.
+func reloadOnHangup(args []string, ydbInstance *Ydb, reloader *tlsReloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		fs, settings, configFile := newStartFlagSet("start", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		err := parseStartConfig(fs, settings, configFile, args, os.LookupEnv)
+		if err == nil {
+			err = ydbInstance.UpdateConfig(settings.Config)
+		}
+		if err != nil {
+			ydbInstance.log.Error("failed to reload configuration, keeping the current one", "error", err)
+		} else {
+			ydbInstance.SetLogLevel(settings.LogLevel)
+		}
+		if reloader == nil {
+			continue
+		}
+		if err := reloader.reload(); err != nil {
+			ydbInstance.log.Error("failed to reload TLS certificates, keeping the current ones", "error", err)
+		} else {
+			ydbInstance.log.Info("reloaded TLS certificates")
+		}
+	}
+}
+
+func cliParseConfig(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: ydb config print [--config file] [options]")
+		os.Exit(1)
+	}
+	printCommand, settings, configFile := newStartFlagSet("config print", flag.ExitOnError)
+	printCommand.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ydb config print [--config file] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Print the configuration `ydb start` would use with the same flags and environment.\n\n")
+		printCommand.PrintDefaults()
+	}
+	if err := parseStartConfig(printCommand, settings, configFile, args[1:], os.LookupEnv); err != nil {
+		exitBecause("ydb: " + err.Error())
+	}
+	printStartConfig(os.Stdout, settings)
+}
+
+func cliParseStats(args []string) {
+	statsCommand := flag.NewFlagSet("stats", flag.ExitOnError)
+	addr := statsCommand.String("addr", "localhost:8899", "Address of the Ydb instance")
+	interval := statsCommand.Duration("interval", 2*time.Second, "Refresh interval")
+	top := statsCommand.Int("top", 10, "Number of busiest rooms to show")
+	jsonOutput := statsCommand.Bool("json", false, "Print the stats once as JSON and exit")
+
+	statsCommand.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ydb stats [--addr addr] [--interval d] [--top n] [--json]\n\n")
+		statsCommand.PrintDefaults()
+	}
+	statsCommand.Parse(args)
+	if len(statsCommand.Args()) != 0 {
+		fmt.Fprintln(os.Stderr, "ydb: too many arguments")
+		fmt.Fprintln(os.Stderr, "Try 'ydb stats --help' for more information")
+		os.Exit(1)
+	}
+
+	url := statsURL(*addr)
+	client := &http.Client{Timeout: 10 * time.Second}
+	if *jsonOutput {
+		st, err := fetchStats(client, url)
+		if err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(st)
+		return
+	}
+
+	var prev *Stats
+	for {
+		st, err := fetchStats(client, url)
+		if err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+		// Clear the terminal and redraw from the top
+		fmt.Print("\033[H\033[2J")
+		renderStats(os.Stdout, prev, st, *top)
+		prev = st
+		time.Sleep(*interval)
+	}
+}
+
+// roomBackend is what `ydb cli` needs from a Ydb instance. It is implemented
+// by *Ydb for --dir and by the admin API client for --addr.
+type roomBackend interface {
+	RoomLog(room YjsRoomName) ([]byte, error)
+	ReplaceRoomContent(room YjsRoomName, update []byte) error
+	AppendUpdate(room YjsRoomName, update []byte) error
+	AuditRecords(room YjsRoomName) ([]AuditRecord, uint32, error)
+	CreateRoom(room YjsRoomName, update []byte) error
+	CreateRoomFrom(src, dst YjsRoomName) error
+	CreateRoomAt(src, dst YjsRoomName, offset uint32) error
+}
+
+const cliUsage = `usage: ydb cli <command> (--dir dir | --addr addr) <room> [file]
+       ydb cli copy (--dir dir | --addr addr) [--offset offset] <room> <new room>
+
+available commands:
+   dump      Write the raw room log
+   decode    List the framed sync messages of the room log
+   export    Write the room content as a single Yjs update, or as JSON with --format json
+   import    Replace the room content with a Yjs update
+   append    Append a Yjs update to the room
+   create    Create the room with a Yjs update, unless it has content
+   copy      Create a new room with the content of the room, as of --offset if given
+   verify    Check the audit chain of the room against its log
+
+dump and export write to file, import, append and create read from file.
+Without file (or with "-"), stdout and stdin are used.
+
+`
+
+func cliParseCli(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, cliUsage)
+		os.Exit(1)
+	}
+	command := args[0]
+	cliCommand := flag.NewFlagSet("cli "+command, flag.ExitOnError)
+	dir := cliCommand.String("dir", "", "Data directory of a Ydb instance (the instance should not be running)")
+	addr := cliCommand.String("addr", "", "Address of a Ydb instance started with --admin")
+	var opts cliOptions
+	cliCommand.StringVar(&opts.format, "format", "update", "Output format of export: update or json")
+	cliCommand.Int64Var(&opts.offset, "offset", -1, "Log offset of the room whose content copy takes, e.g. of a version")
+	auditKeyFile := cliCommand.String("audit-key-file", "", "File holding the secret that keys the audit chain; overrides the one of the config")
+	configFile := cliCommand.String("config", "", "Config file of the Ydb instance of --dir, as given to ydb start; also YDB_CONFIG")
+
+	cliCommand.Usage = func() {
+		fmt.Fprint(os.Stderr, cliUsage)
+		cliCommand.PrintDefaults()
+	}
+	cliCommand.Parse(args[1:])
+	if (*dir == "") == (*addr == "") {
+		fmt.Fprintln(os.Stderr, "ydb: exactly one of --dir and --addr is required")
+		fmt.Fprintln(os.Stderr, "Try 'ydb cli --help' for more information")
+		os.Exit(1)
+	}
+	operands := cliCommand.Args()
+	if len(operands) < 1 || len(operands) > 2 {
+		fmt.Fprintln(os.Stderr, "ydb: expected <room> [file]")
+		fmt.Fprintln(os.Stderr, "Try 'ydb cli --help' for more information")
+		os.Exit(1)
+	}
+	file := "-"
+	if len(operands) == 2 {
+		file = operands[1]
+	}
+	if *auditKeyFile != "" {
+		key, err := readAuditKey(*auditKeyFile)
+		if err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+		opts.auditKey = key
+	}
+
+	var backend roomBackend
+	if *dir != "" {
+		// Writes must keep the audit chain and the journal the way the
+		// instance does, so the instance's settings apply
+		cfg, err := cliDirConfig(*configFile)
+		if err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+		if opts.auditKey != nil {
+			cfg.AuditKey = opts.auditKey
+		}
+		opts.auditKey = cfg.AuditKey
+		ydbInstance := InitYdb(NewDiskStore(*dir, WithMaxRoomSize(cfg.MaxRoomSize)), NewLocalBroadcaster(cfg.BroadcastBuffer), cfg)
+		defer ydbInstance.Close()
+		if err := checkAuditedWrite(ydbInstance, command, YjsRoomName(operands[0]), YjsRoomName(file)); err != nil {
+			exitBecause("ydb: " + err.Error())
+		}
+		backend = ydbInstance
+	} else {
+		backend = newAdminClient(*addr)
+	}
+	if err := runCliCommand(backend, command, YjsRoomName(operands[0]), file, opts); err != nil {
+		exitBecause("ydb: " + err.Error())
+	}
+}
+
+// cliDirConfig loads the config ydb start would use with the config file and
+// the environment.
+func cliDirConfig(configFile string) (Config, error) {
+	fs, settings, file := newStartFlagSet("cli", flag.ContinueOnError)
+	*file = configFile
+	if err := parseStartConfig(fs, settings, file, nil, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	return settings.Config, nil
+}
+
+// checkAuditedWrite refuses commands that write to a room with an audit chain
+// when auditing is off, since the written data would break the chain.
+func checkAuditedWrite(ydb *Ydb, command string, room, target YjsRoomName) error {
+	as, ok := ydb.store.(AuditStore)
+	if !ok || ydb.config().Audit {
+		return nil
+	}
+	switch command {
+	case "import", "append", "create":
+	case "copy":
+		room = target
+	default:
+		return nil
+	}
+	if _, ok, err := as.LastAudit(room); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("room %s has an audit chain, but audit is off; set it in the --config file or with YDB_AUDIT", room)
+	}
+	return nil
+}
+
+// cliOptions holds the ydb cli flags that only some commands use.
+type cliOptions struct {
+	format   string // of export: "update" or "json"
+	offset   int64  // of copy, -1 copies the whole room
+	auditKey []byte // of verify
+}
+
+func runCliCommand(backend roomBackend, command string, room YjsRoomName, file string, opts cliOptions) error {
+	switch command {
+	case "dump", "decode", "export":
+		data, err := backend.RoomLog(room)
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "decode":
+			buf := &bytes.Buffer{}
+			err = printRoomLog(buf, data)
+			data = buf.Bytes()
+		case "export":
+			data, err = exportRoomLog(data, opts.format)
+		}
+		if err != nil {
+			return err
+		}
+		if file == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(file, data, 0600)
+	case "copy":
+		if file == "-" {
+			return errors.New("copy needs the name of the new room")
+		}
+		if opts.offset >= 0 {
+			return backend.CreateRoomAt(room, YjsRoomName(file), uint32(opts.offset))
+		}
+		return backend.CreateRoomFrom(room, YjsRoomName(file))
+	case "import", "append", "create":
+		var update []byte
+		var err error
+		if file == "-" {
+			update, err = io.ReadAll(os.Stdin)
+		} else {
+			update, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "import":
+			return backend.ReplaceRoomContent(room, update)
+		case "create":
+			return backend.CreateRoom(room, update)
+		}
+		return backend.AppendUpdate(room, update)
+	case "verify":
+		records, err := verifyAudit(backend, room, opts.auditKey)
+		if err != nil {
+			return err
+		}
+		head := ""
+		if len(records) > 0 {
+			head = records[len(records)-1].Hash
+		}
+		fmt.Printf("%s: %d audit records verified, head %s\n", room, len(records), head)
+		return nil
+	}
+	return fmt.Errorf("unknown cli command %q", command)
+}
+
+// exportRoomLog renders the content of a room log in the given format.
+func exportRoomLog(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "", "update":
+		return mergeRoomLog(data)
+	case "json":
+		doc, err := docFromLog(data)
+		if err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		err = writeJSON(out, doc.ToJSON(), "  ")
+		return out.Bytes(), err
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// printRoomLog writes one line per framed message of a room log.
+func printRoomLog(w io.Writer, data []byte) error {
+	entries, err := decodeRoomLog(data)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OFFSET\tSIZE\tTYPE")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%d\t%d\t%s\n", e.Offset, e.Size, e.Type)
+	}
+	tw.Flush()
+	return err
 }
 
 func main() {
@@ -58,6 +407,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "   start     Start a Ydb instance\n")
 		fmt.Fprintf(os.Stderr, "   cli       Retrieve and modify content of a Ydb instance\n")
 		fmt.Fprintf(os.Stderr, "   stats     Print live stats about a Ydb instance\n")
+		fmt.Fprintf(os.Stderr, "   config    Print the effective configuration of `ydb start`\n")
 	}
 	if *version {
 		fmt.Println("ydb version 0.0.0")
@@ -71,6 +421,12 @@ func main() {
 	switch os.Args[1] {
 	case "start":
 		cliParseStart(os.Args[2:])
+	case "cli":
+		cliParseCli(os.Args[2:])
+	case "stats":
+		cliParseStats(os.Args[2:])
+	case "config":
+		cliParseConfig(os.Args[2:])
 	default:
 		flag.Usage()
 		os.Exit(1)
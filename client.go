@@ -3,7 +3,7 @@ package ydb
 import (
 	"bytes"
 	"encoding/binary"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -67,6 +67,15 @@ func (client *client) readMessage(message []byte) error {
 			delete(client.unconfirmed, client.nextExpectedConfirmation)
 			client.nextExpectedConfirmation++
 		}
+	case messagePermissionDenied:
+		if err != nil {
+			return err
+		}
+		reason, err := readString(buf)
+		if err != nil {
+			return err
+		}
+		slog.Warn("update rejected by server", "room", client.currentRoom, "reason", reason)
 	}
 	return err
 }
@@ -100,7 +109,7 @@ func (client *client) Connect(url string) (err error) {
 					return
 				}
 				if rerr := client.readMessage(message); rerr != nil {
-					log.Printf("failed to read message from client: %v - %v", rerr, message)
+					slog.Warn("failed to read message from server", "error", rerr, "size", len(message))
 				}
 			}
 		}()
@@ -1,14 +1,66 @@
 package ydb
 
-import "time"
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
 
+// Config configures a Ydb instance. Bounds are checked by Validate.
 type Config struct {
-	SendBufferSize   int
-	MaxMessageSize   int64
-	MaxRoomSize      uint32
-	BroadcastBuffer  int
-	RoomIdleTimeout  time.Duration
+	// Logger receives structured logs; nil discards them
+	Logger *slog.Logger
+	// SendBufferSize is the number of messages queued per connection before
+	// the sender blocks. 1 to 1<<20.
+	SendBufferSize int
+	// MaxMessageSize is the largest accepted websocket message in bytes; 0
+	// disables the limit. It must not exceed a non-zero MaxRoomSize.
+	MaxMessageSize int64
+	// MaxRoomSize is the largest amount of data stored per room in bytes; 0
+	// disables the limit.
+	MaxRoomSize uint32
+	// BroadcastBuffer is the per-subscriber buffer of the built-in
+	// broadcaster. Must not be negative.
+	BroadcastBuffer int
+	// RoomIdleTimeout is how long a room without sessions stays loaded. Must
+	// not be negative.
+	RoomIdleTimeout time.Duration
+	// RoomReapInterval is how often idle rooms are unloaded. Must be positive.
 	RoomReapInterval time.Duration
+	// EventHandler, if set, receives room and session lifecycle events
+	EventHandler EventHandler
+	// EventQueueSize is the capacity of the event queue; 0 uses the default.
+	// Must not be negative.
+	EventQueueSize int
+	// Webhooks, if set, is notified of every update right after it was
+	// persisted, independently of the event queue
+	Webhooks *WebhookDispatcher
+	// Interceptors inspect, reject or rewrite updates before they are
+	// persisted. Entries must not be nil.
+	Interceptors []UpdateInterceptor
+	// Token bucket limits for incoming messages, zero values disable them.
+	// Rates and bursts must be finite and not negative, and a burst needs
+	// the matching rate.
+	SessionRateLimit RateLimit
+	RoomRateLimit    RateLimit
+	IPRateLimit      RateLimit
+	// RateLimitAction is one of RateLimitDrop, RateLimitDelay and RateLimitDisconnect.
+	RateLimitAction RateLimitAction
+	// Journal records a JournalEntry for every update written to a room, if
+	// the store implements JournalStore
+	Journal bool
+	// Audit appends every update to the hash chained audit log of its room,
+	// if the store implements AuditStore
+	Audit bool
+	// AuditKey keys the audit chain with HMAC-SHA256, so that records can't
+	// be rewritten without it. Records written with another key, or without
+	// one, fail verification.
+	AuditKey []byte
+	// MaxSubdocs is how many subdocuments a websocket session can have open
+	// at once; 0 disables the limit. Must not be negative.
+	MaxSubdocs int
 }
 
 func DefaultConfig() Config {
@@ -19,5 +71,130 @@ func DefaultConfig() Config {
 		BroadcastBuffer:  64,
 		RoomIdleTimeout:  5 * time.Minute,
 		RoomReapInterval: 1 * time.Minute,
+		EventQueueSize:   defaultEventQueueSize,
+		MaxSubdocs:       1000,
 	}
 }
+
+// config returns the current configuration. The returned Config must not be modified.
+func (ydb *Ydb) config() *Config {
+	return ydb.cfg.Load()
+}
+
+// UpdateConfig atomically replaces the configuration of a running instance.
+// Open connections are kept: MaxMessageSize applies from the next message,
+// MaxRoomSize, Interceptors and the rate limits from the next update (rate
+// limiters start over with full buckets), RoomIdleTimeout and RoomReapInterval
+// from the next reaper run, MaxSubdocs from the next subdocument a session
+// opens. SendBufferSize only affects new connections.
+//
+// Logger, EventHandler, EventQueueSize and Webhooks are fixed when the instance is
+// created; their values in cfg are ignored. A cfg that fails Validate is
+// rejected and the current configuration stays in place.
+func (ydb *Ydb) UpdateConfig(cfg Config) error {
+	ydb.cfgMux.Lock()
+	defer ydb.cfgMux.Unlock()
+	current := ydb.config()
+	cfg.Logger = current.Logger
+	cfg.EventHandler = current.EventHandler
+	cfg.EventQueueSize = current.EventQueueSize
+	cfg.Webhooks = current.Webhooks
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	ydb.cfg.Store(&cfg)
+	if cfg.RoomReapInterval != current.RoomReapInterval {
+		select {
+		case ydb.reapReset <- struct{}{}:
+		default:
+		}
+	}
+	ydb.log.Info("configuration updated")
+	return nil
+}
+
+// maxSendBufferSize bounds SendBufferSize; every connection allocates its queue up front.
+const maxSendBufferSize = 1 << 20
+
+// FieldError describes an invalid Config field.
+type FieldError struct {
+	Field  string // e.g. "RoomReapInterval" or "SessionRateLimit.MessageBurst"
+	Value  any
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s (got %v)", e.Field, e.Reason, e.Value)
+}
+
+// ConfigError lists every invalid field of a Config.
+type ConfigError struct {
+	Fields []*FieldError
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+func (e *ConfigError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, f := range e.Fields {
+		errs[i] = f
+	}
+	return errs
+}
+
+// Validate checks the bounds documented on the Config fields. It returns nil
+// or a *ConfigError listing all invalid fields.
+func (cfg Config) Validate() error {
+	var fields []*FieldError
+	check := func(ok bool, field string, value any, reason string) {
+		if !ok {
+			fields = append(fields, &FieldError{Field: field, Value: value, Reason: reason})
+		}
+	}
+	check(cfg.SendBufferSize >= 1 && cfg.SendBufferSize <= maxSendBufferSize,
+		"SendBufferSize", cfg.SendBufferSize, fmt.Sprintf("must be between 1 and %d", maxSendBufferSize))
+	check(cfg.MaxMessageSize >= 0, "MaxMessageSize", cfg.MaxMessageSize, "must not be negative")
+	check(cfg.MaxRoomSize == 0 || cfg.MaxMessageSize <= int64(cfg.MaxRoomSize),
+		"MaxMessageSize", cfg.MaxMessageSize, fmt.Sprintf("must not exceed MaxRoomSize %d", cfg.MaxRoomSize))
+	check(cfg.BroadcastBuffer >= 0, "BroadcastBuffer", cfg.BroadcastBuffer, "must not be negative")
+	check(cfg.RoomIdleTimeout >= 0, "RoomIdleTimeout", cfg.RoomIdleTimeout, "must not be negative")
+	check(cfg.RoomReapInterval > 0, "RoomReapInterval", cfg.RoomReapInterval, "must be positive")
+	check(cfg.EventQueueSize >= 0, "EventQueueSize", cfg.EventQueueSize, "must not be negative")
+	check(cfg.MaxSubdocs >= 0, "MaxSubdocs", cfg.MaxSubdocs, "must not be negative")
+	for i, interceptor := range cfg.Interceptors {
+		f, isFunc := interceptor.(UpdateInterceptorFunc)
+		check(interceptor != nil && (!isFunc || f != nil), fmt.Sprintf("Interceptors[%d]", i), interceptor, "must not be nil")
+	}
+	for _, rl := range []struct {
+		name  string
+		limit RateLimit
+	}{
+		{"SessionRateLimit", cfg.SessionRateLimit},
+		{"RoomRateLimit", cfg.RoomRateLimit},
+		{"IPRateLimit", cfg.IPRateLimit},
+	} {
+		l := rl.limit
+		check(validRate(l.MessagesPerSecond), rl.name+".MessagesPerSecond", l.MessagesPerSecond, "must be a finite, non-negative number")
+		check(validRate(l.BytesPerSecond), rl.name+".BytesPerSecond", l.BytesPerSecond, "must be a finite, non-negative number")
+		check(l.MessageBurst >= 0, rl.name+".MessageBurst", l.MessageBurst, "must not be negative")
+		check(l.ByteBurst >= 0, rl.name+".ByteBurst", l.ByteBurst, "must not be negative")
+		check(l.MessageBurst <= 0 || l.MessagesPerSecond > 0, rl.name+".MessageBurst", l.MessageBurst, "requires MessagesPerSecond")
+		check(l.ByteBurst <= 0 || l.BytesPerSecond > 0, rl.name+".ByteBurst", l.ByteBurst, "requires BytesPerSecond")
+	}
+	check(cfg.RateLimitAction >= RateLimitDrop && cfg.RateLimitAction <= RateLimitDisconnect,
+		"RateLimitAction", cfg.RateLimitAction, "must be RateLimitDrop, RateLimitDelay or RateLimitDisconnect")
+	if len(fields) > 0 {
+		return &ConfigError{Fields: fields}
+	}
+	return nil
+}
+
+func validRate(r float64) bool {
+	return r >= 0 && !math.IsInf(r, 0) && !math.IsNaN(r)
+}
@@ -0,0 +1,241 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpdateConfigRejectsInvalidConfig(t *testing.T) {
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+
+	cfg := DefaultConfig()
+	cfg.RoomReapInterval = 0
+	if err := ydbInstance.UpdateConfig(cfg); err == nil {
+		t.Fatal("expected a zero RoomReapInterval to be rejected")
+	}
+	if ydbInstance.config().RoomReapInterval != DefaultConfig().RoomReapInterval {
+		t.Fatal("rejected config was applied")
+	}
+}
+
+func TestUpdateConfigKeepsFixedFields(t *testing.T) {
+	handler := &NopEventHandler{}
+	cfg := DefaultConfig()
+	cfg.EventHandler = handler
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+
+	if err := ydbInstance.UpdateConfig(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if ydbInstance.config().EventHandler != handler || ydbInstance.config().EventQueueSize != cfg.EventQueueSize {
+		t.Fatal("EventHandler must not change at runtime")
+	}
+}
+
+func TestUpdateConfigMaxRoomSize(t *testing.T) {
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	s := ydbInstance.createSession("room")
+	s.setConn(&mockConn{})
+	ydbInstance.subscribeRoom(s, 0)
+
+	update := makeYjsSyncUpdate(bytes.Repeat([]byte{1}, 100))
+	if err := ydbInstance.updateRoom("room", s, update); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.MaxRoomSize = 150
+	cfg.MaxMessageSize = 150
+	if err := ydbInstance.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ydbInstance.updateRoom("room", s, update); !errors.Is(err, ErrRoomTooLarge) {
+		t.Fatalf("expected ErrRoomTooLarge for the existing session, got %v", err)
+	}
+}
+
+// slowAppendStore widens the window between the size check and the append.
+type slowAppendStore struct {
+	Store
+}
+
+func (s slowAppendStore) Append(room YjsRoomName, data []byte) (uint32, error) {
+	time.Sleep(time.Millisecond)
+	return s.Store.Append(room, data)
+}
+
+func TestMaxRoomSizeConcurrentWrites(t *testing.T) {
+	store := slowAppendStore{newMemoryStore()}
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	update := makeYjsSyncUpdate(bytes.Repeat([]byte{1}, 100))
+	if err := ydbInstance.updateRoom("size", nil, update); err != nil {
+		t.Fatal(err)
+	}
+	framed, _ := store.Size("size")
+
+	cfg := DefaultConfig()
+	cfg.MaxRoomSize = 3*framed + framed/2
+	cfg.MaxMessageSize = int64(cfg.MaxRoomSize)
+	if err := ydbInstance.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var written atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ydbInstance.updateRoom("room", nil, update) == nil {
+				written.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if size, _ := store.Size("room"); written.Load() != 3 || size > cfg.MaxRoomSize {
+		t.Fatalf("%d writes of %d bytes passed, room has %d bytes, max %d", written.Load(), framed, size, cfg.MaxRoomSize)
+	}
+}
+
+func TestUpdateConfigRoomReapInterval(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RoomIdleTimeout = time.Millisecond
+	cfg.RoomReapInterval = time.Hour
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+	ydbInstance.getOrCreateRoom("idle")
+
+	cfg.RoomReapInterval = 10 * time.Millisecond
+	if err := ydbInstance.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*time.Second, func() bool { return len(ydbInstance.Rooms()) == 0 })
+}
+
+func TestUpdateConfigMaxMessageSizeOpenConnection(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.dial(t, "room")
+	client.sendSyncUpdate([]byte("small"))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("room")
+		return size > 0
+	})
+
+	cfg := *ts.ydb.config()
+	cfg.MaxMessageSize = 64
+	if err := ts.ydb.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	client.sendSyncUpdate(bytes.Repeat([]byte{1}, 1024))
+	if _, closed := client.waitClosed(2 * time.Second); !closed {
+		t.Fatal("expected the connection to be closed for a message over the new limit")
+	}
+}
+
+func TestUpdateConfigRateLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RoomRateLimit = RateLimit{MessagesPerSecond: 1}
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+
+	before := ydbInstance.roomRateLimiter("room")
+	if before == nil || before != ydbInstance.roomRateLimiter("room") {
+		t.Fatal("expected a stable room limiter")
+	}
+	cfg.RoomRateLimit = RateLimit{MessagesPerSecond: 100}
+	if err := ydbInstance.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	after := ydbInstance.roomRateLimiter("room")
+	if after == before || after.limit.MessagesPerSecond != 100 {
+		t.Fatal("expected the room limiter to follow the new config")
+	}
+	cfg.RoomRateLimit = RateLimit{}
+	ydbInstance.UpdateConfig(cfg)
+	if ydbInstance.roomRateLimiter("room") != nil {
+		t.Fatal("expected room rate limiting to be disabled")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	nan := 0.0
+	nan = nan / nan
+	cases := []struct {
+		name   string
+		modify func(*Config)
+		fields []string // invalid fields, in report order
+	}{
+		{"default", func(c *Config) {}, nil},
+		{"unlimited sizes", func(c *Config) { c.MaxMessageSize, c.MaxRoomSize = 0, 0 }, nil},
+		{"message size without room limit", func(c *Config) { c.MaxMessageSize, c.MaxRoomSize = 1<<40, 0 }, nil},
+		{"zero send buffer", func(c *Config) { c.SendBufferSize = 0 }, []string{"SendBufferSize"}},
+		{"huge send buffer", func(c *Config) { c.SendBufferSize = maxSendBufferSize + 1 }, []string{"SendBufferSize"}},
+		{"negative message size", func(c *Config) { c.MaxMessageSize = -1 }, []string{"MaxMessageSize"}},
+		{"message larger than room", func(c *Config) { c.MaxMessageSize, c.MaxRoomSize = 2048, 1024 }, []string{"MaxMessageSize"}},
+		{"negative broadcast buffer", func(c *Config) { c.BroadcastBuffer = -1 }, []string{"BroadcastBuffer"}},
+		{"negative idle timeout", func(c *Config) { c.RoomIdleTimeout = -time.Second }, []string{"RoomIdleTimeout"}},
+		{"zero reap interval", func(c *Config) { c.RoomReapInterval = 0 }, []string{"RoomReapInterval"}},
+		{"negative reap interval", func(c *Config) { c.RoomReapInterval = -time.Second }, []string{"RoomReapInterval"}},
+		{"negative event queue", func(c *Config) { c.EventQueueSize = -1 }, []string{"EventQueueSize"}},
+		{"negative subdocument limit", func(c *Config) { c.MaxSubdocs = -1 }, []string{"MaxSubdocs"}},
+		{"nil interceptor", func(c *Config) { c.Interceptors = []UpdateInterceptor{UpdateInterceptorFunc(nil), nil} }, []string{"Interceptors[0]", "Interceptors[1]"}},
+		{"negative rate", func(c *Config) { c.SessionRateLimit.MessagesPerSecond = -1 }, []string{"SessionRateLimit.MessagesPerSecond"}},
+		{"NaN rate", func(c *Config) { c.RoomRateLimit.BytesPerSecond = nan }, []string{"RoomRateLimit.BytesPerSecond"}},
+		{"negative burst", func(c *Config) { c.IPRateLimit = RateLimit{BytesPerSecond: 1, ByteBurst: -1} }, []string{"IPRateLimit.ByteBurst"}},
+		{"burst without rate", func(c *Config) { c.IPRateLimit.MessageBurst = 10 }, []string{"IPRateLimit.MessageBurst"}},
+		{"unknown action", func(c *Config) { c.RateLimitAction = 7 }, []string{"RateLimitAction"}},
+		{"several fields", func(c *Config) { c.SendBufferSize, c.RoomReapInterval, c.RateLimitAction = 0, 0, -1 },
+			[]string{"SendBufferSize", "RoomReapInterval", "RateLimitAction"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			c.modify(&cfg)
+			err := cfg.Validate()
+			if len(c.fields) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("expected *ConfigError, got %v", err)
+			}
+			if len(cfgErr.Fields) != len(c.fields) {
+				t.Fatalf("expected fields %v, got %v", c.fields, err)
+			}
+			for i, f := range cfgErr.Fields {
+				if f.Field != c.fields[i] {
+					t.Errorf("field %d = %s, want %s", i, f.Field, c.fields[i])
+				}
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != c.fields[0] {
+				t.Errorf("expected errors.As to find the first FieldError, got %v", fieldErr)
+			}
+		})
+	}
+}
+
+func TestNewYdb(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RoomReapInterval = 0
+	if _, err := NewYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg); err == nil {
+		t.Fatal("expected NewYdb to reject an invalid config")
+	}
+	if _, err := NewYdb(nil, NewLocalBroadcaster(64), DefaultConfig()); err == nil {
+		t.Fatal("expected NewYdb to reject a nil store")
+	}
+	ydbInstance, err := NewYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ydbInstance.Close()
+}
@@ -7,4 +7,6 @@ import (
 type conn interface {
 	// sends data to the client
 	WriteMessage(m []byte, pm *websocket.PreparedMessage)
+	// closes the connection, telling the client why
+	Close(code int, reason string)
 }
@@ -4,7 +4,10 @@ import "context"
 
 type contextKey uint8
 
-const readOnlySessionContextKey contextKey = iota
+const (
+	readOnlySessionContextKey contextKey = iota
+	principalContextKey
+)
 
 // WithReadOnlySession marks a websocket request as read-only. The session can
 // receive room history and updates, but client sync messages are not applied.
@@ -16,3 +19,14 @@ func isReadOnlySession(ctx context.Context) bool {
 	readOnly, _ := ctx.Value(readOnlySessionContextKey).(bool)
 	return readOnly
 }
+
+// WithPrincipal attaches the authenticated identity of the requester to a
+// websocket request. It is reported in events for the session.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+func principalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalContextKey).(string)
+	return principal
+}
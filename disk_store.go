@@ -1,10 +1,16 @@
 package ydb
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type DiskStoreOption func(*DiskStore)
@@ -15,6 +21,10 @@ func WithMaxRoomSize(size uint32) DiskStoreOption {
 	}
 }
 
+// WithInitialContentProvider fills rooms that don't exist yet with the framed
+// log fn returns, on their first read or write. The content bypasses the
+// interceptors, journal and audit; Ydb.CreateRoom and Ydb.CreateRoomFrom create
+// rooms from templates with any store.
 func WithInitialContentProvider(fn func(roomName string) []byte) DiskStoreOption {
 	return func(ds *DiskStore) {
 		ds.initialContentProvider = fn
@@ -48,6 +58,13 @@ func (ds *DiskStore) roomPath(room YjsRoomName) string {
 	return filepath.Join(ds.dir, string(room))
 }
 
+// createRoomPath is roomPath for writes; rooms with hierarchical names
+// such as "team/notes" get their parent directories created.
+func (ds *DiskStore) createRoomPath(room YjsRoomName) (string, error) {
+	path := ds.roomPath(room)
+	return path, os.MkdirAll(filepath.Dir(path), 0700)
+}
+
 func (ds *DiskStore) ensureInitialContent(room YjsRoomName) {
 	if ds.initialContentProvider == nil {
 		return
@@ -61,7 +78,9 @@ func (ds *DiskStore) ensureInitialContent(room YjsRoomName) {
 	}
 	content := ds.initialContentProvider(string(room))
 	if len(content) > 0 {
-		os.WriteFile(path, content, 0600)
+		if path, err := ds.createRoomPath(room); err == nil {
+			os.WriteFile(path, content, 0600)
+		}
 	}
 }
 
@@ -71,12 +90,14 @@ func (ds *DiskStore) Append(room YjsRoomName, data []byte) (uint32, error) {
 	defer mu.Unlock()
 
 	ds.ensureInitialContent(room)
-	path := ds.roomPath(room)
+	path, err := ds.createRoomPath(room)
+	if err != nil {
+		return 0, err
+	}
 
 	if ds.maxRoomSize > 0 {
 		var currentSize uint32
-		fi, err := os.Stat(path)
-		if err == nil {
+		if fi, err := os.Stat(path); err == nil {
 			currentSize = uint32(fi.Size())
 		}
 		if currentSize+uint32(len(data)) > ds.maxRoomSize {
@@ -166,6 +187,375 @@ func (ds *DiskStore) SetInitialContent(room YjsRoomName, data []byte) error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	path := ds.roomPath(room)
+	path, err := ds.createRoomPath(room)
+	if err != nil {
+		return err
+	}
 	return os.WriteFile(path, data, 0600)
 }
+
+func (ds *DiskStore) Delete(room YjsRoomName) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := os.Remove(ds.roomPath(room))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrRoomNotFound
+		}
+		return err
+	}
+	ds.initialized.Delete(room)
+	return ds.moveSideData(room, "")
+}
+
+func (ds *DiskStore) Rename(from, to YjsRoomName) error {
+	if from == to {
+		return nil
+	}
+	// Lock in a stable order so concurrent renames can't deadlock
+	first, second := from, to
+	if second < first {
+		first, second = second, first
+	}
+	mu1, mu2 := ds.roomMutex(first), ds.roomMutex(second)
+	mu1.Lock()
+	defer mu1.Unlock()
+	mu2.Lock()
+	defer mu2.Unlock()
+
+	src, dst := ds.roomPath(from), ds.roomPath(to)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return ErrRoomNotFound
+		}
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return ErrRoomExists
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	ds.initialized.Delete(from)
+	ds.initialized.Store(to, struct{}{})
+	return ds.moveSideData(from, to)
+}
+
+// sideDataDir holds data kept about rooms, one subdirectory per kind. As a
+// dot directory it is skipped by List, and room names can't address it.
+const sideDataDir = ".ydb"
+
+func (ds *DiskStore) sidePath(kind string, room YjsRoomName) string {
+	return filepath.Join(ds.dir, sideDataDir, kind, string(room))
+}
+
+// moveSideData moves the side data of every kind from one room to another,
+// replacing what the target had. An empty to deletes the side data.
+func (ds *DiskStore) moveSideData(from, to YjsRoomName) error {
+	kinds, err := os.ReadDir(filepath.Join(ds.dir, sideDataDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, kind := range kinds {
+		src := ds.sidePath(kind.Name(), from)
+		if to != "" {
+			dst := ds.sidePath(kind.Name(), to)
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+				return err
+			}
+			if err := os.Rename(src, dst); err != nil {
+				return err
+			}
+		} else if err := os.Remove(src); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DiskStore) AddVersion(room YjsRoomName, v Version) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+
+	versions, err := ds.readVersions(room)
+	if err != nil {
+		return err
+	}
+	for _, existing := range versions {
+		if existing.Name == v.Name {
+			return ErrVersionExists
+		}
+	}
+	return appendJSONLine(ds.sidePath("versions", room), v)
+}
+
+func (ds *DiskStore) Versions(room YjsRoomName) ([]Version, error) {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+	return ds.readVersions(room)
+}
+
+// readVersions reads the versions file, one JSON encoded Version per line.
+func (ds *DiskStore) readVersions(room YjsRoomName) ([]Version, error) {
+	versions, err := readJSONLines[Version](ds.sidePath("versions", room))
+	if err != nil {
+		return nil, fmt.Errorf("versions of room %s: %w", room, err)
+	}
+	return versions, nil
+}
+
+func (ds *DiskStore) DeleteVersions(room YjsRoomName) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := os.Remove(ds.sidePath("versions", room))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (ds *DiskStore) AppendJournal(room YjsRoomName, entry JournalEntry) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+	return appendJSONLine(ds.sidePath("journal", room), entry)
+}
+
+func (ds *DiskStore) Journal(room YjsRoomName, since, until time.Time) ([]JournalEntry, error) {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	entries, err := readJSONLines[JournalEntry](ds.sidePath("journal", room))
+	mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("journal of room %s: %w", room, err)
+	}
+	matching := entries[:0]
+	for _, e := range entries {
+		if (since.IsZero() || !e.Time.Before(since)) && (until.IsZero() || e.Time.Before(until)) {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
+func (ds *DiskStore) AppendAudit(room YjsRoomName, rec AuditRecord) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+	return appendJSONLine(ds.sidePath("audit", room), rec)
+}
+
+func (ds *DiskStore) LastAudit(room YjsRoomName) (AuditRecord, bool, error) {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+	var rec AuditRecord
+	ok, err := readLastJSONLine(ds.sidePath("audit", room), &rec)
+	if err != nil {
+		return rec, false, fmt.Errorf("audit chain of room %s: %w", room, err)
+	}
+	return rec, ok, nil
+}
+
+func (ds *DiskStore) AuditRecords(room YjsRoomName) ([]AuditRecord, error) {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+	records, err := readJSONLines[AuditRecord](ds.sidePath("audit", room))
+	if err != nil {
+		return nil, fmt.Errorf("audit chain of room %s: %w", room, err)
+	}
+	return records, nil
+}
+
+func (ds *DiskStore) SetForkInfo(room YjsRoomName, info ForkInfo) error {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	path := ds.sidePath("forks", room)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Room names can't start with a dot, so the temporary file can't be the file of another room
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (ds *DiskStore) ForkInfo(room YjsRoomName) (ForkInfo, bool, error) {
+	mu := ds.roomMutex(room)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var info ForkInfo
+	data, err := os.ReadFile(ds.sidePath("forks", room))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return info, false, nil
+		}
+		return info, false, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, false, fmt.Errorf("fork of room %s: %w", room, err)
+	}
+	return info, true, nil
+}
+
+// appendJSONLine appends v as a line of JSON to a side data file.
+func appendJSONLine(path string, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// readJSONLines reads a file written by appendJSONLine; a missing file has no lines.
+func readJSONLines[T any](path string) ([]T, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var values []T
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// readLastJSONLine decodes the last line of a file written by appendJSONLine
+// into v, reading the file backwards until it finds the start of the line.
+func readLastJSONLine(path string, v any) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := info.Size()
+	for chunk := int64(1024); ; chunk *= 2 {
+		start := max(size-chunk, 0)
+		buf := make([]byte, size-start)
+		if _, err := f.ReadAt(buf, start); err != nil {
+			return false, err
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 || start == 0 {
+			line := buf[i+1:]
+			if len(line) == 0 {
+				return false, nil
+			}
+			return true, json.Unmarshal(line, v)
+		}
+	}
+}
+
+func (ds *DiskStore) List(prefix, cursor string, limit int) ([]RoomStat, string, error) {
+	var rooms []RoomStat
+	err := filepath.WalkDir(ds.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == ds.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Dot directories hold side data, not rooms
+			if path != ds.dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(ds.dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) || name <= cursor {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rooms = append(rooms, RoomStat{
+			Name:    YjsRoomName(name),
+			Size:    uint32(fi.Size()),
+			ModTime: fi.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	var next string
+	if limit > 0 && len(rooms) > limit {
+		rooms = rooms[:limit]
+		next = string(rooms[limit-1].Name)
+	}
+	return rooms, next, nil
+}
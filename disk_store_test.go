@@ -1,7 +1,9 @@
 package ydb
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
 )
@@ -245,3 +247,93 @@ func TestDiskStoreReadNonExistent(t *testing.T) {
 		t.Fatalf("expected offset 0, got %d", offset)
 	}
 }
+
+func TestDiskStoreDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDiskStore(dir).(*DiskStore)
+
+	room := YjsRoomName("doomed")
+	store.Append(room, []byte("data"))
+
+	if err := store.Delete(room); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	size, _ := store.Size(room)
+	if size != 0 {
+		t.Fatalf("expected size 0 after delete, got %d", size)
+	}
+	if err := store.Delete(room); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestDiskStoreRename(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDiskStore(dir).(*DiskStore)
+
+	store.Append("old", []byte("content"))
+	store.Append("taken", []byte("other"))
+
+	if err := store.Rename("old", "taken"); !errors.Is(err, ErrRoomExists) {
+		t.Fatalf("expected ErrRoomExists, got %v", err)
+	}
+	if err := store.Rename("missing", "new"); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+	if err := store.Rename("old", "new"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+
+	data, _, _ := store.ReadFrom("new", 0)
+	if string(data) != "content" {
+		t.Fatalf("expected renamed content, got %q", data)
+	}
+	size, _ := store.Size("old")
+	if size != 0 {
+		t.Fatalf("expected old room to be empty, got size %d", size)
+	}
+}
+
+func TestDiskStoreListPagination(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDiskStore(dir).(*DiskStore)
+
+	for _, name := range []string{"doc-c", "doc-a", "other", "doc-b"} {
+		store.Append(YjsRoomName(name), []byte(name))
+	}
+
+	page, next, err := store.List("doc-", "", 2)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page) != 2 || page[0].Name != "doc-a" || page[1].Name != "doc-b" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if next != "doc-b" {
+		t.Fatalf("expected cursor doc-b, got %q", next)
+	}
+	if page[0].Size != uint32(len("doc-a")) || page[0].ModTime.IsZero() {
+		t.Fatalf("expected size and mod time, got %+v", page[0])
+	}
+
+	page, next, err = store.List("doc-", next, 2)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "doc-c" || next != "" {
+		t.Fatalf("unexpected last page: %+v next=%q", page, next)
+	}
+
+	all, _, _ := store.List("", "", 0)
+	if len(all) != 4 {
+		t.Fatalf("expected 4 rooms, got %d", len(all))
+	}
+}
+
+func TestDiskStoreListMissingDir(t *testing.T) {
+	store := NewDiskStore(filepath.Join(t.TempDir(), "missing")).(*DiskStore)
+	rooms, next, err := store.List("", "", 10)
+	if err != nil || len(rooms) != 0 || next != "" {
+		t.Fatalf("expected empty listing, got %v %q %v", rooms, next, err)
+	}
+}
@@ -0,0 +1,139 @@
+package ydb
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const defaultEventQueueSize = 1024
+
+// EventHandler receives room and session lifecycle events. Callbacks are invoked
+// from a single dispatcher goroutine, in the order the events happened. Events are
+// queued in a bounded buffer (Config.EventQueueSize) and dropped when it is full,
+// so a slow handler never stalls the write path.
+type EventHandler interface {
+	OnRoomLoaded(RoomEvent)
+	OnRoomIdle(RoomEvent)
+	OnRoomReaped(RoomEvent)
+	OnSessionJoined(SessionEvent)
+	OnSessionLeft(SessionEvent)
+	OnUpdate(UpdateEvent)
+}
+
+// NopEventHandler implements EventHandler with no-op callbacks. Embed it to
+// handle only the events you care about.
+type NopEventHandler struct{}
+
+func (NopEventHandler) OnRoomLoaded(RoomEvent)       {}
+func (NopEventHandler) OnRoomIdle(RoomEvent)         {}
+func (NopEventHandler) OnRoomReaped(RoomEvent)       {}
+func (NopEventHandler) OnSessionJoined(SessionEvent) {}
+func (NopEventHandler) OnSessionLeft(SessionEvent)   {}
+func (NopEventHandler) OnUpdate(UpdateEvent)         {}
+
+// SessionInfo identifies the session an event originates from.
+type SessionInfo struct {
+	ID         uint64
+	Principal  string
+	RemoteAddr string
+	ReadOnly   bool
+}
+
+type RoomEvent struct {
+	Room YjsRoomName
+	Time time.Time
+}
+
+type SessionEvent struct {
+	Room    YjsRoomName
+	Session SessionInfo
+	Time    time.Time
+}
+
+// UpdateEvent is emitted after an update was persisted. Size is the length of
+// the sync message, Offset the room offset after the append.
+type UpdateEvent struct {
+	Room    YjsRoomName
+	Session SessionInfo
+	Size    int
+	Offset  uint32
+	Time    time.Time
+}
+
+type eventQueue struct {
+	handler EventHandler
+	ch      chan func(EventHandler)
+	dropped uint64
+	log     *slog.Logger
+}
+
+func newEventQueue(handler EventHandler, size int, log *slog.Logger) *eventQueue {
+	if size <= 0 {
+		size = defaultEventQueueSize
+	}
+	return &eventQueue{
+		handler: handler,
+		ch:      make(chan func(EventHandler), size),
+		log:     log,
+	}
+}
+
+func (q *eventQueue) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case fn := <-q.ch:
+			q.deliver(fn)
+		}
+	}
+}
+
+func (q *eventQueue) deliver(fn func(EventHandler)) {
+	defer func() {
+		if err := recover(); err != nil {
+			q.log.Error("event handler panicked", "error", err)
+		}
+	}()
+	fn(q.handler)
+}
+
+func (q *eventQueue) push(fn func(EventHandler)) {
+	select {
+	case q.ch <- fn:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+}
+
+// emit queues an event for the configured EventHandler, if any.
+func (ydb *Ydb) emit(fn func(EventHandler)) {
+	if ydb.events != nil {
+		ydb.events.push(fn)
+	}
+}
+
+// DroppedEvents returns the number of events discarded because the event queue was full.
+func (ydb *Ydb) DroppedEvents() uint64 {
+	if ydb.events == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&ydb.events.dropped)
+}
+
+func (ydb *Ydb) emitRoomEvent(name YjsRoomName, cb func(EventHandler, RoomEvent)) {
+	if ydb.events == nil {
+		return
+	}
+	ev := RoomEvent{Room: name, Time: time.Now()}
+	ydb.emit(func(h EventHandler) { cb(h, ev) })
+}
+
+func (ydb *Ydb) emitSessionEvent(s *session, cb func(EventHandler, SessionEvent)) {
+	if ydb.events == nil {
+		return
+	}
+	ev := SessionEvent{Room: s.roomname, Session: s.info(), Time: time.Now()}
+	ydb.emit(func(h EventHandler) { cb(h, ev) })
+}
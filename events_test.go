@@ -0,0 +1,163 @@
+package ydb
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type recordingEventHandler struct {
+	NopEventHandler
+	mu     sync.Mutex
+	events []string
+	update UpdateEvent
+	joined SessionEvent
+}
+
+func (h *recordingEventHandler) record(s string) {
+	h.mu.Lock()
+	h.events = append(h.events, s)
+	h.mu.Unlock()
+}
+
+func (h *recordingEventHandler) OnRoomLoaded(ev RoomEvent) { h.record("loaded:" + string(ev.Room)) }
+func (h *recordingEventHandler) OnRoomIdle(ev RoomEvent)   { h.record("idle:" + string(ev.Room)) }
+func (h *recordingEventHandler) OnRoomReaped(ev RoomEvent) { h.record("reaped:" + string(ev.Room)) }
+
+func (h *recordingEventHandler) OnSessionJoined(ev SessionEvent) {
+	h.mu.Lock()
+	h.joined = ev
+	h.mu.Unlock()
+	h.record("joined:" + string(ev.Room))
+}
+
+func (h *recordingEventHandler) OnSessionLeft(ev SessionEvent) { h.record("left:" + string(ev.Room)) }
+
+func (h *recordingEventHandler) OnUpdate(ev UpdateEvent) {
+	h.mu.Lock()
+	h.update = ev
+	h.mu.Unlock()
+	h.record(fmt.Sprintf("update:%s:%d", ev.Room, ev.Size))
+}
+
+func (h *recordingEventHandler) has(s string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.events {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEventsRoomAndSessionLifecycle(t *testing.T) {
+	handler := &recordingEventHandler{}
+	cfg := Config{
+		SendBufferSize:   256,
+		MaxMessageSize:   10 * 1024 * 1024,
+		MaxRoomSize:      50 * 1024 * 1024,
+		BroadcastBuffer:  64,
+		RoomIdleTimeout:  50 * time.Millisecond,
+		RoomReapInterval: 25 * time.Millisecond,
+		EventHandler:     handler,
+	}
+	ts := newTestServerWithConfig(t, cfg)
+
+	conn, _, err := websocket.DefaultDialer.Dial(ts.wsURL+"/ws/evroom", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	msg := makeYjsSyncUpdate([]byte("payload"))
+	conn.WriteMessage(websocket.BinaryMessage, msg)
+
+	waitFor(t, 2*time.Second, func() bool {
+		return handler.has("loaded:evroom") && handler.has("joined:evroom") &&
+			handler.has(fmt.Sprintf("update:evroom:%d", len(msg)))
+	})
+
+	handler.mu.Lock()
+	update, joined := handler.update, handler.joined
+	handler.mu.Unlock()
+	if update.Session.ID == 0 || update.Session.ID != joined.Session.ID {
+		t.Fatalf("update and join should carry the same session id: %+v %+v", update.Session, joined.Session)
+	}
+	if joined.Session.RemoteAddr == "" {
+		t.Fatalf("expected remote address in session info")
+	}
+	size, _ := ts.store.Size("evroom")
+	if update.Offset != size {
+		t.Fatalf("expected update offset %d, got %d", size, update.Offset)
+	}
+
+	conn.Close()
+	waitFor(t, 2*time.Second, func() bool {
+		return handler.has("left:evroom") && handler.has("idle:evroom") && handler.has("reaped:evroom")
+	})
+}
+
+func TestEventsCarryPrincipal(t *testing.T) {
+	handler := &recordingEventHandler{}
+	cfg := DefaultConfig()
+	cfg.EventHandler = handler
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+
+	req, _ := http.NewRequest("GET", "/ws/room", nil)
+	ctx := WithPrincipal(req.Context(), "alice")
+	if got := principalFromContext(ctx); got != "alice" {
+		t.Fatalf("expected principal alice, got %q", got)
+	}
+
+	s := ydbInstance.createSession("room")
+	s.principal = principalFromContext(ctx)
+	s.setConn(&mockConn{})
+	ydbInstance.subscribeRoom(s, 0)
+
+	waitFor(t, time.Second, func() bool { return handler.has("joined:room") })
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.joined.Session.Principal != "alice" {
+		t.Fatalf("expected principal in join event, got %+v", handler.joined.Session)
+	}
+}
+
+type blockingEventHandler struct {
+	NopEventHandler
+	release chan struct{}
+}
+
+func (h *blockingEventHandler) OnUpdate(UpdateEvent) { <-h.release }
+
+func TestEventsSlowHandlerDoesNotBlockWrites(t *testing.T) {
+	handler := &blockingEventHandler{release: make(chan struct{})}
+	cfg := DefaultConfig()
+	cfg.EventHandler = handler
+	cfg.EventQueueSize = 4
+	store := newMemoryStore()
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), cfg)
+	defer ydbInstance.Close()
+	defer close(handler.release)
+
+	s := ydbInstance.createSession("slow")
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			ydbInstance.updateRoom("slow", s, makeYjsSyncUpdate([]byte("x")))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("updates blocked on slow event handler")
+	}
+	if ydbInstance.DroppedEvents() == 0 {
+		t.Fatalf("expected events to be dropped when the queue is full")
+	}
+}
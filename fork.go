@@ -0,0 +1,155 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotAFork is returned by MergeFork for rooms that weren't created by Fork.
+var ErrNotAFork = errors.New("room is not a fork")
+
+// Fork creates the room child with the current content of parent and records
+// parent as its origin, e.g. for a draft that is edited privately and merged
+// back with MergeFork. It fails with ErrRoomExists if child already has
+// content. The store must implement ForkStore; if recording the link fails,
+// child is deleted again, which needs a RoomManager.
+func (ydb *Ydb) Fork(parent, child YjsRoomName) (ForkInfo, error) {
+	fs, ok := ydb.store.(ForkStore)
+	if !ok {
+		return ForkInfo{}, ErrNotSupported
+	}
+	data, err := ydb.RoomLog(parent)
+	if err != nil {
+		return ForkInfo{}, err
+	}
+	doc, err := docFromLog(data)
+	if err != nil {
+		return ForkInfo{}, err
+	}
+	if len(doc.stateVector()) == 0 {
+		return ForkInfo{}, fmt.Errorf("%w: %s has no content", ErrRoomNotFound, parent)
+	}
+	update, err := doc.EncodeStateAsUpdate(nil)
+	if err != nil {
+		return ForkInfo{}, err
+	}
+	if err := ydb.CreateRoom(child, update); err != nil {
+		return ForkInfo{}, err
+	}
+	info := ForkInfo{
+		Parent:      parent,
+		Offset:      uint32(len(data)),
+		StateVector: doc.EncodeStateVector(),
+		Time:        time.Now().UTC(),
+	}
+	if err := fs.SetForkInfo(child, info); err != nil {
+		// A child without its link would only be a copy, and a retry would
+		// fail with ErrRoomExists
+		if derr := ydb.DeleteRoom(child); derr != nil {
+			ydb.log.Error("failed to remove fork without parent link", "room", child, "parent", parent, "error", derr)
+		}
+		return ForkInfo{}, err
+	}
+	ydb.log.Info("room forked", "room", child, "parent", parent, "offset", info.Offset)
+	return info, nil
+}
+
+// ForkInfo returns the parent link of a room created by Fork; ok is false for
+// other rooms. The store must implement ForkStore.
+func (ydb *Ydb) ForkInfo(room YjsRoomName) (info ForkInfo, ok bool, err error) {
+	fs, supported := ydb.store.(ForkStore)
+	if !supported {
+		return ForkInfo{}, false, ErrNotSupported
+	}
+	return fs.ForkInfo(room)
+}
+
+// MergeFork applies the changes made to a fork since it was created, or last
+// merged, to its parent. The changes are written like a client update, so
+// sessions of the parent receive them; edits made to the parent in the
+// meantime are kept, as Yjs merges concurrent changes without conflicts. The
+// fork stays usable and can be merged again.
+func (ydb *Ydb) MergeFork(child YjsRoomName) error {
+	info, ok, err := ydb.ForkInfo(child)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotAFork
+	}
+	sv, err := decodeStateVector(info.StateVector)
+	if err != nil {
+		return fmt.Errorf("fork of room %s: invalid state vector: %w", child, err)
+	}
+	childLog, err := ydb.RoomLog(child)
+	if err != nil {
+		return err
+	}
+	childDoc, err := docFromLog(childLog)
+	if err != nil {
+		return err
+	}
+	parentLog, err := ydb.RoomLog(info.Parent)
+	if err != nil {
+		return err
+	}
+	parentDoc, err := docFromLog(parentLog)
+	if err != nil {
+		return err
+	}
+	if diff := mergeDiff(childDoc, parentDoc, sv); diff != nil {
+		if err := ydb.updateRoom(info.Parent, nil, encodeSyncMessage(messageYjsUpdate, diff)); err != nil {
+			return err
+		}
+		ydb.log.Info("fork merged", "room", child, "parent", info.Parent, "size", len(diff))
+	}
+	info.StateVector = childDoc.EncodeStateVector()
+	info.Merges++
+	return ydb.store.(ForkStore).SetForkInfo(child, info)
+}
+
+// mergeDiff returns the update that brings parent up to date with child: the
+// structs child has beyond the state vector sv and the deletions parent
+// doesn't have yet. It returns nil if there are none.
+func mergeDiff(child, parent *Doc, sv map[uint64]uint64) []byte {
+	changed := false
+	for client, clock := range child.stateVector() {
+		changed = changed || clock > sv[client]
+	}
+	var deletes []yDeleteRange
+	add := func(client, clock, length uint64) {
+		if n := len(deletes); n > 0 && deletes[n-1].client == client && deletes[n-1].clock+deletes[n-1].len == clock {
+			deletes[n-1].len += length
+		} else {
+			deletes = append(deletes, yDeleteRange{client: client, clock: clock, len: length})
+		}
+	}
+	for _, r := range child.deleteSet() {
+		for clock, end := r.clock, r.clock+r.len; clock < end; {
+			item := parent.find(yID{client: r.client, clock: clock})
+			if item == nil || item.id.clock+item.length <= clock {
+				// Unknown to the parent, the struct comes with the diff
+				add(r.client, clock, end-clock)
+				break
+			}
+			next := min(item.id.clock+item.length, end)
+			if !item.deleted && !item.gc {
+				add(r.client, clock, next-clock)
+			}
+			clock = next
+		}
+	}
+	// Pending structs and deletes wait for structs the child hasn't seen, so
+	// they are passed on as they are
+	deletes = append(deletes, child.pendingDs...)
+	changed = changed || len(child.pending) > 0
+	if !changed && len(deletes) == 0 {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	child.writeStructsSince(buf, sv, child.pending)
+	writeDeleteSet(buf, deletes)
+	return buf.Bytes()
+}
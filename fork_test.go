@@ -0,0 +1,104 @@
+package ydb
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustEdit(t *testing.T, ydbInstance *Ydb, room YjsRoomName, fn func(doc *Doc) error) {
+	t.Helper()
+	if err := ydbInstance.Edit(room, fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeFork(t *testing.T) {
+	ts := newDiskTestServer(t)
+	mustEdit(t, ts.ydb, "doc", func(doc *Doc) error { return doc.GetText("text").Insert(0, "hello world") })
+
+	info, err := ts.ydb.Fork("doc", "draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := ts.store.Size("doc"); info.Parent != "doc" || info.Offset != size {
+		t.Fatalf("unexpected fork info %+v", info)
+	}
+	if _, err := ts.ydb.Fork("doc", "draft"); !errors.Is(err, ErrRoomExists) {
+		t.Fatalf("expected ErrRoomExists, got %v", err)
+	}
+	if err := ts.ydb.MergeFork("doc"); !errors.Is(err, ErrNotAFork) {
+		t.Fatalf("expected ErrNotAFork, got %v", err)
+	}
+
+	// The draft and the parent change concurrently
+	mustEdit(t, ts.ydb, "draft", func(doc *Doc) error {
+		text := doc.GetText("text")
+		if err := text.Delete(0, 6); err != nil {
+			return err
+		}
+		return text.Insert(5, "!")
+	})
+	mustEdit(t, ts.ydb, "doc", func(doc *Doc) error { return doc.GetText("text").Insert(0, ">> ") })
+
+	if err := ts.ydb.MergeFork("draft"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ts.ydb.RoomJSON("doc"); got["text"] != ">> world!" {
+		t.Fatalf("unexpected merged content %v", got)
+	}
+	if got, _ := ts.ydb.RoomJSON("draft"); got["text"] != "world!" {
+		t.Fatalf("merge changed the draft: %v", got)
+	}
+	info, ok, err := ts.ydb.ForkInfo("draft")
+	if err != nil || !ok || info.Merges != 1 {
+		t.Fatalf("unexpected fork info %+v %v %v", info, ok, err)
+	}
+
+	// Merging again without changes writes nothing
+	size, _ := ts.store.Size("doc")
+	if err := ts.ydb.MergeFork("draft"); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := ts.store.Size("doc"); after != size {
+		t.Fatalf("empty merge wrote %d bytes", after-size)
+	}
+
+	// Only the changes since the last merge are applied
+	mustEdit(t, ts.ydb, "draft", func(doc *Doc) error { return doc.GetText("text").Insert(5, " wide") })
+	if err := ts.ydb.MergeFork("draft"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ts.ydb.RoomJSON("doc"); got["text"] != ">> world wide!" {
+		t.Fatalf("unexpected merged content %v", got)
+	}
+}
+
+func TestForkNotSupported(t *testing.T) {
+	ts := newTestServer(t)
+	mustEdit(t, ts.ydb, "doc", func(doc *Doc) error { return doc.GetText("text").Insert(0, "a") })
+	if _, err := ts.ydb.Fork("doc", "draft"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+// linklessStore fails to record fork links.
+type linklessStore struct {
+	*DiskStore
+}
+
+func (linklessStore) SetForkInfo(YjsRoomName, ForkInfo) error {
+	return errors.New("disk full")
+}
+
+func TestForkRollback(t *testing.T) {
+	store := linklessStore{NewDiskStore(t.TempDir()).(*DiskStore)}
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	mustEdit(t, ydbInstance, "doc", func(doc *Doc) error { return doc.GetText("text").Insert(0, "a") })
+	if _, err := ydbInstance.Fork("doc", "draft"); err == nil {
+		t.Fatal("expected the failed link to be reported")
+	}
+	if size, _ := store.Size("draft"); size != 0 {
+		t.Fatalf("expected the fork to be removed, %d bytes left", size)
+	}
+}
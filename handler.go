@@ -0,0 +1,174 @@
+package ydb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RoomResolver determines the room a websocket request wants to join.
+// Returning an *HTTPError controls the response status; any other error is
+// answered with 400 Bad Request.
+type RoomResolver func(r *http.Request) (YjsRoomName, error)
+
+// HTTPError is an error with an HTTP status code.
+type HTTPError struct {
+	Status  int
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// HandlerOption configures NewWsHandler, NewRestHandler and NewSSEHandler.
+type HandlerOption func(*roomHandler)
+
+// WithRoomResolver replaces the default room resolution.
+func WithRoomResolver(resolver RoomResolver) HandlerOption {
+	return func(h *roomHandler) {
+		h.resolve = resolver
+	}
+}
+
+// WithRoomPathPrefix makes the default resolver take the room name from the
+// request path after prefix, so that names can contain slashes: with prefix
+// "/ws/", a request to /ws/team/notes joins room "team/notes".
+func WithRoomPathPrefix(prefix string) HandlerOption {
+	return func(h *roomHandler) {
+		h.pathPrefix = prefix
+	}
+}
+
+// WithHeartbeatInterval sets how often NewSSEHandler sends heartbeat events
+// on an idle stream; the default is 15s.
+func WithHeartbeatInterval(interval time.Duration) HandlerOption {
+	return func(h *roomHandler) {
+		h.heartbeat = interval
+	}
+}
+
+// WithSubdocResolver replaces how NewWsHandler maps the GUIDs of subdocuments
+// to rooms; by default a subdocument is stored in the room "<room>~<guid>",
+// with the GUID path escaped.
+func WithSubdocResolver(resolver SubdocResolver) HandlerOption {
+	return func(h *roomHandler) {
+		h.subdocRoom = resolver
+	}
+}
+
+// roomNameContextKey is typed so it can't collide with keys of other packages.
+type roomNameContextKey struct{}
+
+// WithRoomName sets the room of a websocket request, e.g. from a router's
+// path parameters. It takes precedence over every other source.
+func WithRoomName(ctx context.Context, room YjsRoomName) context.Context {
+	return context.WithValue(ctx, roomNameContextKey{}, room)
+}
+
+// roomHandler resolves the room of requests for the websocket, REST and SSE handlers.
+type roomHandler struct {
+	ydb        *Ydb
+	resolve    RoomResolver
+	pathPrefix string
+	heartbeat  time.Duration
+	subdocRoom SubdocResolver
+}
+
+func newRoomHandler(ydbInstance *Ydb, opts []HandlerOption) roomHandler {
+	h := roomHandler{ydb: ydbInstance}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	if h.resolve == nil {
+		h.resolve = h.defaultRoomResolver
+	}
+	return h
+}
+
+// room resolves and validates the room of r. On failure it responds with the
+// error and returns false.
+func (h *roomHandler) room(w http.ResponseWriter, r *http.Request) (YjsRoomName, bool) {
+	room, err := h.resolve(r)
+	if err == nil {
+		err = validateRoomName(room)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Status
+		}
+		h.ydb.log.Info("rejected request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "status", status, "error", err)
+		http.Error(w, err.Error(), status)
+		return "", false
+	}
+	return room, true
+}
+
+type wsHandler struct {
+	roomHandler
+}
+
+// NewWsHandler returns the websocket handler. Without WithRoomResolver the
+// room is taken from, in order:
+//
+//   - WithRoomName on the request context
+//   - the legacy "roomname" string context value
+//   - the {room} path wildcard of an http.ServeMux pattern such as "/ws/{room...}"
+//   - the room query parameter, as in y-websocket's ws://host/ws?room=name
+//   - the path after WithRoomPathPrefix, or else the last path segment
+//
+// Requests for an empty or invalid room name are rejected with 400 Bad Request.
+func NewWsHandler(ydbInstance *Ydb, opts ...HandlerOption) http.Handler {
+	return &wsHandler{newRoomHandler(ydbInstance, opts)}
+}
+
+func (h *roomHandler) defaultRoomResolver(r *http.Request) (YjsRoomName, error) {
+	if room, ok := r.Context().Value(roomNameContextKey{}).(YjsRoomName); ok {
+		return room, nil
+	}
+	if room, ok := r.Context().Value("roomname").(string); ok {
+		return YjsRoomName(room), nil
+	}
+	if room := r.PathValue("room"); room != "" {
+		return YjsRoomName(room), nil
+	}
+	if room := r.URL.Query().Get("room"); room != "" {
+		return YjsRoomName(room), nil
+	}
+	if h.pathPrefix != "" {
+		room, ok := strings.CutPrefix(r.URL.Path, h.pathPrefix)
+		if !ok {
+			return "", &HTTPError{Status: http.StatusNotFound, Message: "no room at " + r.URL.Path}
+		}
+		return YjsRoomName(room), nil
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	return YjsRoomName(parts[len(parts)-1]), nil
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if room, ok := h.room(w, r); ok {
+		h.ydb.serveWs(w, r, room, h.subdocRoom)
+	}
+}
+
+// validateRoomName accepts slash separated names whose segments are not
+// empty and don't start with a dot, so that names map safely onto paths.
+func validateRoomName(room YjsRoomName) error {
+	if room == "" {
+		return &HTTPError{Status: http.StatusBadRequest, Message: "missing room name"}
+	}
+	if strings.ContainsAny(string(room), "\x00\\") {
+		return &HTTPError{Status: http.StatusBadRequest, Message: "invalid room name"}
+	}
+	for _, segment := range strings.Split(string(room), "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return &HTTPError{Status: http.StatusBadRequest, Message: "invalid room name"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package ydb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefaultRoomResolver(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix string
+		req    func() *http.Request
+		room   YjsRoomName
+	}{
+		{"last segment", "", func() *http.Request { return httptest.NewRequest("GET", "/ws/notes", nil) }, "notes"},
+		{"path prefix", "/ws/", func() *http.Request { return httptest.NewRequest("GET", "/ws/team/notes", nil) }, "team/notes"},
+		{"query", "/ws/", func() *http.Request { return httptest.NewRequest("GET", "/ws?room=team%2Fnotes", nil) }, "team/notes"},
+		{"path value", "", func() *http.Request {
+			r := httptest.NewRequest("GET", "/ws/team/notes?room=other", nil)
+			r.SetPathValue("room", "team/notes")
+			return r
+		}, "team/notes"},
+		{"legacy context key", "", func() *http.Request {
+			r := httptest.NewRequest("GET", "/ws/other?room=other", nil)
+			return r.WithContext(context.WithValue(r.Context(), "roomname", "legacy"))
+		}, "legacy"},
+		{"typed context key", "", func() *http.Request {
+			r := httptest.NewRequest("GET", "/ws/other?room=other", nil)
+			ctx := context.WithValue(r.Context(), "roomname", "legacy")
+			return r.WithContext(WithRoomName(ctx, "typed"))
+		}, "typed"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewWsHandler(nil, WithRoomPathPrefix(c.prefix)).(*wsHandler)
+			room, err := h.resolve(c.req())
+			if err != nil || room != c.room {
+				t.Fatalf("got %q (%v), want %q", room, err, c.room)
+			}
+		})
+	}
+}
+
+func TestWsHandlerRejectsUnresolvableRooms(t *testing.T) {
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	forbidden := WithRoomResolver(func(r *http.Request) (YjsRoomName, error) {
+		return "", &HTTPError{Status: http.StatusForbidden, Message: "not yours"}
+	})
+	failing := WithRoomResolver(func(r *http.Request) (YjsRoomName, error) {
+		return "", errors.New("no room")
+	})
+	cases := []struct {
+		name    string
+		handler http.Handler
+		target  string
+		status  int
+	}{
+		{"empty segment", NewWsHandler(ydbInstance, WithRoomPathPrefix("/ws/")), "/ws/team//notes", http.StatusBadRequest},
+		{"dot segment", NewWsHandler(ydbInstance, WithRoomPathPrefix("/ws/")), "/ws/team/../notes", http.StatusBadRequest},
+		{"hidden segment", NewWsHandler(ydbInstance, WithRoomPathPrefix("/ws/")), "/ws/.ydb", http.StatusBadRequest},
+		{"missing room", NewWsHandler(ydbInstance, WithRoomPathPrefix("/ws/")), "/ws/", http.StatusBadRequest},
+		{"outside prefix", NewWsHandler(ydbInstance, WithRoomPathPrefix("/ws/")), "/other", http.StatusNotFound},
+		{"resolver status", NewWsHandler(ydbInstance, forbidden), "/ws/notes", http.StatusForbidden},
+		{"resolver error", NewWsHandler(ydbInstance, failing), "/ws/notes", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.handler.ServeHTTP(w, httptest.NewRequest("GET", c.target, nil))
+			if w.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestHierarchicalRoomOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestServerWithComponents(t, NewDiskStore(dir), NewLocalBroadcaster(64), DefaultConfig())
+	client := ts.dialPath(t, "/tree/", "team/notes")
+	client.sendSyncUpdate([]byte("hello"))
+	waitFor(t, 2*time.Second, func() bool {
+		fi, err := os.Stat(filepath.Join(dir, "team", "notes"))
+		return err == nil && fi.Size() > 0
+	})
+	if rooms := ts.ydb.Rooms(); len(rooms) != 1 || rooms[0].Name != "team/notes" {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+}
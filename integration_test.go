@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestWsSingleClientUpdate(t *testing.T) {
@@ -313,3 +315,66 @@ func TestWsReconnectCatchup(t *testing.T) {
 		t.Fatalf("catch-up payload mismatch: got %v", innerPayload)
 	}
 }
+
+func TestWsDeleteRoomClosesSessions(t *testing.T) {
+	ts := newTestServer(t)
+	roomname := "to-be-deleted"
+
+	c := ts.dial(t, roomname)
+	c.sendSyncUpdate([]byte("doomed-update"))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size(YjsRoomName(roomname))
+		return size > 0
+	})
+
+	if err := ts.ydb.DeleteRoom(YjsRoomName(roomname)); err != nil {
+		t.Fatalf("DeleteRoom failed: %v", err)
+	}
+
+	err, ok := c.waitClosed(2 * time.Second)
+	if !ok {
+		t.Fatal("client was not disconnected")
+	}
+	if !websocket.IsCloseError(err, CloseRoomDeleted) {
+		t.Fatalf("expected close code %d, got %v", CloseRoomDeleted, err)
+	}
+	size, _ := ts.store.Size(YjsRoomName(roomname))
+	if size != 0 {
+		t.Fatalf("expected room data to be deleted, size=%d", size)
+	}
+}
+
+func TestWsRenameRoomClosesWithNewName(t *testing.T) {
+	ts := newTestServer(t)
+
+	c := ts.dial(t, "before")
+	c.sendSyncUpdate([]byte("moving-update"))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("before")
+		return size > 0
+	})
+
+	if err := ts.ydb.RenameRoom("before", "after"); err != nil {
+		t.Fatalf("RenameRoom failed: %v", err)
+	}
+
+	err, ok := c.waitClosed(2 * time.Second)
+	if !ok {
+		t.Fatal("client was not disconnected")
+	}
+	closeErr, isClose := err.(*websocket.CloseError)
+	if !isClose || closeErr.Code != CloseRoomRenamed || closeErr.Text != "after" {
+		t.Fatalf("expected close %d with reason %q, got %v", CloseRoomRenamed, "after", err)
+	}
+
+	// Reconnecting under the new name catches up on the moved data
+	c2 := ts.dial(t, "after")
+	msg, ok := c2.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("timed out waiting for catch-up in renamed room")
+	}
+	_, payload, err := parseSyncMessage(msg)
+	if err != nil || !bytes.Equal(payload, []byte("moving-update")) {
+		t.Fatalf("renamed room catch-up mismatch: payload=%q err=%v", payload, err)
+	}
+}
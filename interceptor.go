@@ -0,0 +1,74 @@
+package ydb
+
+import "fmt"
+
+// SyncMessageType is the y-protocols sync sub-type of an update.
+type SyncMessageType uint64
+
+const (
+	SyncStep1  SyncMessageType = messageYjsSyncStep1
+	SyncStep2  SyncMessageType = messageYjsSyncStep2
+	SyncUpdate SyncMessageType = messageYjsUpdate
+)
+
+// Update is an incoming sync message as seen by interceptors.
+type Update struct {
+	Room    YjsRoomName
+	Session SessionInfo
+	Type    SyncMessageType
+	Payload []byte
+}
+
+// UpdateInterceptor inspects an update before it is persisted. Returning an
+// error rejects the update: it is neither stored nor broadcast, and the sending
+// client receives a y-protocols permission-denied message carrying the error
+// text. An interceptor rewrites the update by replacing u.Payload.
+//
+// Interceptors run in the order of Config.Interceptors; each one sees the
+// payload as left by the previous one and the chain stops at the first
+// rejection. Updates of one session pass through the chain in the order they
+// were received.
+type UpdateInterceptor interface {
+	InterceptUpdate(u *Update) error
+}
+
+// UpdateInterceptorFunc adapts a function to the UpdateInterceptor interface.
+type UpdateInterceptorFunc func(u *Update) error
+
+func (f UpdateInterceptorFunc) InterceptUpdate(u *Update) error {
+	return f(u)
+}
+
+// UpdateRejectedError is returned by updateRoom when an interceptor refused an update.
+type UpdateRejectedError struct {
+	Reason string
+}
+
+func (e *UpdateRejectedError) Error() string {
+	return fmt.Sprintf("update rejected: %s", e.Reason)
+}
+
+// interceptUpdate runs the interceptor chain over a sync message and returns
+// the message that should be persisted.
+func (ydb *Ydb) interceptUpdate(roomname YjsRoomName, session *session, bs []byte) ([]byte, error) {
+	interceptors := ydb.config().Interceptors
+	if len(interceptors) == 0 {
+		return bs, nil
+	}
+	syncType, payload, err := decodeSyncMessage(bs)
+	if err != nil {
+		return nil, &UpdateRejectedError{Reason: "malformed sync message"}
+	}
+	u := &Update{
+		Room:    roomname,
+		Session: session.info(),
+		Type:    SyncMessageType(syncType),
+		Payload: payload,
+	}
+	for _, interceptor := range interceptors {
+		if err := interceptor.InterceptUpdate(u); err != nil {
+			return nil, &UpdateRejectedError{Reason: err.Error()}
+		}
+	}
+	return encodeSyncMessage(uint64(u.Type), u.Payload), nil
+}
@@ -0,0 +1,166 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newInterceptorYdb(interceptors ...UpdateInterceptor) (*Ydb, *MemoryStore) {
+	store := newMemoryStore()
+	cfg := DefaultConfig()
+	cfg.Interceptors = interceptors
+	return InitYdb(store, NewLocalBroadcaster(64), cfg), store
+}
+
+func storedSyncPayloads(t *testing.T, store Store, room YjsRoomName) [][]byte {
+	t.Helper()
+	data, _, err := store.ReadFrom(room, 0)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	var payloads [][]byte
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		msg, err := readPayload(reader)
+		if err != nil {
+			t.Fatalf("readPayload failed: %v", err)
+		}
+		_, payload, err := parseSyncMessage(msg)
+		if err != nil {
+			t.Fatalf("parseSyncMessage failed: %v", err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func TestInterceptorAccept(t *testing.T) {
+	var seen Update
+	ydbInstance, store := newInterceptorYdb(UpdateInterceptorFunc(func(u *Update) error {
+		seen = *u
+		return nil
+	}))
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("accept")
+	s.principal = "bob"
+	if err := ydbInstance.updateRoom("accept", s, makeYjsSyncUpdate([]byte("ok"))); err != nil {
+		t.Fatalf("updateRoom failed: %v", err)
+	}
+
+	if seen.Room != "accept" || seen.Type != SyncUpdate || string(seen.Payload) != "ok" {
+		t.Fatalf("interceptor saw unexpected update: %+v", seen)
+	}
+	if seen.Session.ID != s.sessionid || seen.Session.Principal != "bob" {
+		t.Fatalf("interceptor saw unexpected session: %+v", seen.Session)
+	}
+	payloads := storedSyncPayloads(t, store, "accept")
+	if len(payloads) != 1 || string(payloads[0]) != "ok" {
+		t.Fatalf("expected accepted update to be stored, got %q", payloads)
+	}
+}
+
+func TestInterceptorRejectNotifiesClient(t *testing.T) {
+	ydbInstance, store := newInterceptorYdb(UpdateInterceptorFunc(func(u *Update) error {
+		return errors.New("no swearing")
+	}))
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("reject")
+	mc := &mockConn{}
+	s.setConn(mc)
+
+	err := ydbInstance.updateRoom("reject", s, makeYjsSyncUpdate([]byte("bad")))
+	var rejected *UpdateRejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != "no swearing" {
+		t.Fatalf("expected UpdateRejectedError, got %v", err)
+	}
+	if size, _ := store.Size("reject"); size != 0 {
+		t.Fatalf("rejected update should not be stored, size=%d", size)
+	}
+
+	msgs := mc.getMessages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected one permission denied message, got %d", len(msgs))
+	}
+	buf := bytes.NewBuffer(msgs[0])
+	msgType, _ := binary.ReadUvarint(buf)
+	reason, _ := readString(buf)
+	if msgType != messagePermissionDenied || reason != "no swearing" {
+		t.Fatalf("unexpected rejection message: type=%d reason=%q", msgType, reason)
+	}
+
+	// Our client must not take it for a confirmation
+	c := newClient()
+	c.unconfirmed[0] = []byte{}
+	if err := c.readMessage(msgs[0]); err != nil || len(c.unconfirmed) != 1 {
+		t.Fatalf("permission denied read as confirmation: %v, %d unconfirmed", err, len(c.unconfirmed))
+	}
+}
+
+func TestInterceptorRewriteIsStoredAndBroadcast(t *testing.T) {
+	store := newMemoryStore()
+	cfg := DefaultConfig()
+	cfg.Interceptors = []UpdateInterceptor{UpdateInterceptorFunc(func(u *Update) error {
+		u.Payload = bytes.ReplaceAll(u.Payload, []byte("secret"), []byte("******"))
+		return nil
+	})}
+	ts := newTestServerWithComponents(t, store, NewLocalBroadcaster(64), cfg)
+
+	writer := ts.dial(t, "rewrite")
+	reader := ts.dial(t, "rewrite")
+	time.Sleep(100 * time.Millisecond)
+
+	writer.sendSyncUpdate([]byte("my secret"))
+	msg, ok := reader.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("reader timed out waiting for broadcast")
+	}
+	_, payload, err := parseSyncMessage(msg)
+	if err != nil || string(payload) != "my ******" {
+		t.Fatalf("expected redacted broadcast, got %q err=%v", payload, err)
+	}
+
+	payloads := storedSyncPayloads(t, store, "rewrite")
+	if len(payloads) != 1 || string(payloads[0]) != "my ******" {
+		t.Fatalf("expected redacted update in store, got %q", payloads)
+	}
+}
+
+func TestInterceptorChainOrder(t *testing.T) {
+	var calls []string
+	appendTag := func(tag string) UpdateInterceptor {
+		return UpdateInterceptorFunc(func(u *Update) error {
+			calls = append(calls, tag)
+			u.Payload = append(u.Payload, tag...)
+			return nil
+		})
+	}
+	rejectLong := UpdateInterceptorFunc(func(u *Update) error {
+		calls = append(calls, "limit")
+		if len(u.Payload) > 4 {
+			return errors.New("too long")
+		}
+		return nil
+	})
+	ydbInstance, store := newInterceptorYdb(appendTag("a"), appendTag("b"), rejectLong, appendTag("c"))
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("chain")
+	ydbInstance.updateRoom("chain", s, makeYjsSyncUpdate([]byte("xy")))
+	if got := storedSyncPayloads(t, store, "chain"); len(got) != 1 || string(got[0]) != "xyabc" {
+		t.Fatalf("expected interceptors applied in order, got %q", got)
+	}
+
+	calls = nil
+	ydbInstance.updateRoom("chain", s, makeYjsSyncUpdate([]byte("xyz")))
+	if len(calls) != 3 || calls[2] != "limit" {
+		t.Fatalf("expected chain to stop at rejection, calls=%v", calls)
+	}
+	if got := storedSyncPayloads(t, store, "chain"); len(got) != 1 {
+		t.Fatalf("rejected update should not be stored, got %q", got)
+	}
+}
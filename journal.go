@@ -0,0 +1,35 @@
+package ydb
+
+import "time"
+
+// journalUpdate records who appended size bytes ending at offset to a room.
+// The update is already persisted, so failures are only logged.
+func (ydb *Ydb) journalUpdate(name YjsRoomName, session *session, offset uint32, size int) {
+	js, ok := ydb.store.(JournalStore)
+	if !ok || !ydb.config().Journal {
+		return
+	}
+	info := session.info()
+	entry := JournalEntry{
+		Offset:     offset - uint32(size),
+		EndOffset:  offset,
+		Size:       size,
+		Time:       time.Now().UTC(),
+		Session:    info.ID,
+		Principal:  info.Principal,
+		RemoteAddr: info.RemoteAddr,
+	}
+	if err := js.AppendJournal(name, entry); err != nil {
+		ydb.log.Error("failed to journal update", "room", name, "session", info.ID, "offset", entry.Offset, "error", err)
+	}
+}
+
+// Journal returns the journal entries of a room recorded in [since, until);
+// zero times leave that end open. The store must implement JournalStore.
+func (ydb *Ydb) Journal(name YjsRoomName, since, until time.Time) ([]JournalEntry, error) {
+	js, ok := ydb.store.(JournalStore)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return js.Journal(name, since, until)
+}
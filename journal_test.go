@@ -0,0 +1,76 @@
+package ydb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Journal = true
+	ts := newTestServerWithComponents(t, NewDiskStore(t.TempDir()), NewLocalBroadcaster(64), cfg)
+
+	client := ts.dial(t, "room")
+	client.sendSyncUpdate(testUpdate([]testItem{{client: 1, root: "text", text: "abc"}}))
+	deadline := time.Now().Add(2 * time.Second)
+	for size, _ := ts.store.Size("room"); size == 0; size, _ = ts.store.Size("room") {
+		if time.Now().After(deadline) {
+			t.Fatal("update was not persisted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ts.ydb.AppendUpdate("room", testUpdate([]testItem{{client: 2, root: "text", text: "x"}})); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ts.ydb.Journal("room", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := ts.store.Size("room")
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	first, second := entries[0], entries[1]
+	if first.Session == 0 || first.RemoteAddr == "" || first.Offset != 0 || first.EndOffset != second.Offset {
+		t.Fatalf("unexpected first entry %+v", first)
+	}
+	if second.Session != 0 || second.EndOffset != size || second.Size != int(second.EndOffset-second.Offset) {
+		t.Fatalf("unexpected second entry %+v", second)
+	}
+
+	if entries, _ := ts.ydb.Journal("room", second.Time, time.Time{}); len(entries) != 1 {
+		t.Fatalf("expected since to skip older entries, got %+v", entries)
+	}
+	if entries, _ := ts.ydb.Journal("room", time.Time{}, first.Time); len(entries) != 0 {
+		t.Fatalf("expected until to be exclusive, got %+v", entries)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/rooms/room/journal?since="+url.QueryEscape(second.Time.Format(time.RFC3339Nano)), nil)
+	ts.ydb.AdminHandler().ServeHTTP(rec, req)
+	var listed []JournalEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].Offset != second.Offset {
+		t.Fatalf("unexpected journal response %d %s", rec.Code, rec.Body)
+	}
+
+	if err := ts.ydb.RenameRoom("room", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ts.ydb.Journal("moved", time.Time{}, time.Time{}); len(entries) != 2 {
+		t.Fatal("expected the journal to move with the room")
+	}
+}
+
+func TestJournalDisabled(t *testing.T) {
+	ydbInstance := InitYdb(NewDiskStore(t.TempDir()), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	ydbInstance.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "abc"}}))
+	if entries, err := ydbInstance.Journal("room", time.Time{}, time.Time{}); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no entries, got %+v %v", entries, err)
+	}
+}
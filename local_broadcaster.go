@@ -1,11 +1,15 @@
 package ydb
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
 type LocalBroadcaster struct {
 	mu      sync.RWMutex
 	rooms   map[YjsRoomName]map[uint64]chan []byte
 	bufSize int
+	dropped uint64
 }
 
 func NewLocalBroadcaster(bufferSize int) Broadcaster {
@@ -31,6 +35,7 @@ func (lb *LocalBroadcaster) Publish(room YjsRoomName, senderSessionID uint64, da
 			select {
 			case ch <- msg:
 			default:
+				atomic.AddUint64(&lb.dropped, 1)
 			}
 		}
 	}
@@ -70,3 +75,8 @@ func (lb *LocalBroadcaster) Unsubscribe(room YjsRoomName, sessionID uint64) {
 		delete(lb.rooms, room)
 	}
 }
+
+// Dropped returns the number of messages discarded because a subscriber's buffer was full.
+func (lb *LocalBroadcaster) Dropped() uint64 {
+	return atomic.LoadUint64(&lb.dropped)
+}
@@ -1,7 +1,9 @@
 package ydb
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 )
 
@@ -12,25 +14,57 @@ func exitBecause(messages ...string) {
 	os.Exit(1)
 }
 
-func debug(s string) {
-	//fmt.Println(s)
-}
-
-func debugMessageType(m string, buf []byte) {
-	//mtype := "unknown"
-	//switch buf[0] {
-	//case messageConfirmation:
-	//	mtype = "confirmation"
-	//case messageAwareness:
-	//	mtype = "subscription"
-	//case messageSubConf:
-	//	mtype = "subscription confirmation"
-	//case messageSync:
-	//	mtype = "update"
-	//case messageHostUnconfirmedByClient:
-	//	mtype = "host-unconfirmed-by-client"
-	//case messageConfirmedByHost:
-	//	mtype = "confirmed-by-host"
-	//}
-	//fmt.Printf("%s (type: %s, len: %d)\n", m, mtype, len(buf))
+// levelHandler filters records below a runtime-adjustable level before passing
+// them on, so the verbosity of any logger can be changed via Ydb.SetLogLevel.
+type levelHandler struct {
+	level *slog.LevelVar
+	next  slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.level.Level() && h.next.Enabled(ctx, l)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithGroup(name)}
+}
+
+// newLogger wraps the configured logger. Without one, nothing is logged.
+func newLogger(logger *slog.Logger, level *slog.LevelVar) *slog.Logger {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return slog.New(&levelHandler{level: level, next: logger.Handler()})
+}
+
+// newStderrLogger returns the logger of `ydb start`, which writes text records
+// to stderr and leaves filtering to Ydb.SetLogLevel.
+func newStderrLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// SetLogLevel changes the minimum level of log records emitted by the instance.
+// Records still have to pass the level of the configured logger's handler.
+func (ydb *Ydb) SetLogLevel(level slog.Level) {
+	ydb.logLevel.Set(level)
+}
+
+// debugMessageType logs the type and size of an encoded message at debug level.
+func (ydb *Ydb) debugMessageType(m string, s *session, buf []byte) {
+	if !ydb.log.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	ydb.log.Debug(m,
+		"room", s.roomname,
+		"session", s.sessionid,
+		"type", messageTypeName(buf),
+		"size", len(buf))
 }
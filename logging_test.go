@@ -0,0 +1,140 @@
+package ydb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func newLoggingYdb(t *testing.T, cfg Config) (*Ydb, *syncBuffer) {
+	buf := &syncBuffer{}
+	cfg.Logger = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), cfg)
+	t.Cleanup(ydbInstance.Close)
+	return ydbInstance, buf
+}
+
+func TestLoggingStructuredFields(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxRoomSize = 10
+	ydbInstance, buf := newLoggingYdb(t, cfg)
+
+	s := ydbInstance.createSession("full-room")
+	ydbInstance.updateRoom("full-room", s, makeYjsSyncUpdate([]byte("way too large for this room")))
+
+	records := buf.records(t)
+	if len(records) != 1 {
+		t.Fatalf("expected one log record, got %v", records)
+	}
+	rec := records[0]
+	if rec["level"] != "WARN" || rec["room"] != "full-room" || rec["max"] != float64(10) {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	if rec["session"] != float64(s.sessionid) {
+		t.Fatalf("expected session id in record, got %v", rec["session"])
+	}
+}
+
+func TestLoggingRejectedUpdate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Interceptors = []UpdateInterceptor{UpdateInterceptorFunc(func(u *Update) error {
+		return &UpdateRejectedError{Reason: "read only"}
+	})}
+	ydbInstance, buf := newLoggingYdb(t, cfg)
+
+	update := makeYjsSyncUpdate([]byte("rejected"))
+	ydbInstance.updateRoom("room", nil, update)
+	records := buf.records(t)
+	if len(records) != 1 || records[0]["msg"] != "update rejected" || records[0]["size"] != float64(len(update)) {
+		t.Fatalf("expected the size of the rejected update, got %v", records)
+	}
+}
+
+func TestLoggingDefaultQuiet(t *testing.T) {
+	var level slog.LevelVar
+	level.Set(slog.LevelDebug)
+	if newLogger(nil, &level).Enabled(context.Background(), slog.LevelError) {
+		t.Fatal("expected no logs without a logger")
+	}
+}
+
+func TestLoggingRuntimeDebugLevel(t *testing.T) {
+	ydbInstance, buf := newLoggingYdb(t, DefaultConfig())
+
+	s := ydbInstance.createSession("debug-room")
+	s.setConn(&mockConn{})
+	ydbInstance.readMessage(bytes.NewBuffer(makeYjsSyncUpdate([]byte("x"))), s)
+	if records := buf.records(t); len(records) != 0 {
+		t.Fatalf("debug records should be suppressed by default, got %v", records)
+	}
+
+	ydbInstance.SetLogLevel(slog.LevelDebug)
+	ydbInstance.debugMessageType("sending message to client", s, makeYjsSyncUpdate([]byte("x")))
+	ydbInstance.readMessage(bytes.NewBuffer(makeYjsSyncUpdate([]byte("x"))), s)
+
+	records := buf.records(t)
+	if len(records) != 2 {
+		t.Fatalf("expected two debug records, got %v", records)
+	}
+	if records[0]["type"] != "update" || records[0]["room"] != "debug-room" {
+		t.Fatalf("expected decoded message type, got %v", records[0])
+	}
+
+	ydbInstance.SetLogLevel(slog.LevelInfo)
+	ydbInstance.readMessage(bytes.NewBuffer(makeYjsSyncUpdate([]byte("x"))), s)
+	if records := buf.records(t); len(records) != 2 {
+		t.Fatalf("debug records should stop after raising the level, got %d", len(records))
+	}
+}
+
+func TestMessageTypeName(t *testing.T) {
+	cases := map[string][]byte{
+		"sync_step1":        makeYjsSyncStep1(nil),
+		"update":            makeYjsSyncUpdate(nil),
+		"awareness":         {messageAwareness, 0},
+		"confirmation":      {messageConfirmation, 1},
+		"subdoc":            createMessageSubdoc("guid", makeYjsSyncUpdate(nil)),
+		"subdoc_close":      createMessageSubdocClose("guid"),
+		"permission_denied": createMessagePermissionDenied("no"),
+		"unknown":           {42},
+		"empty":             {},
+	}
+	for want, msg := range cases {
+		if got := messageTypeName(msg); got != want {
+			t.Errorf("messageTypeName(%v) = %q, want %q", msg, got, want)
+		}
+	}
+}
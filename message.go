@@ -16,8 +16,50 @@ const (
 	messageSubConf                 = 3
 	messageHostUnconfirmedByClient = 4
 	messageConfirmedByHost         = 5
+	messageSubdoc                  = 6
+	messageSubdocClose             = 7
+	messagePermissionDenied        = 8
 )
 
+// messageTypeName describes the type of an encoded message, for metrics and logs.
+func messageTypeName(bs []byte) string {
+	if len(bs) == 0 {
+		return "empty"
+	}
+	switch bs[0] {
+	case messageSync:
+		if len(bs) < 2 {
+			return "sync"
+		}
+		switch bs[1] {
+		case messageYjsSyncStep1:
+			return "sync_step1"
+		case messageYjsSyncStep2:
+			return "sync_step2"
+		case messageYjsUpdate:
+			return "update"
+		}
+		return "sync"
+	case messageAwareness:
+		return "awareness"
+	case messageConfirmation:
+		return "confirmation"
+	case messageSubConf:
+		return "subscription_confirmation"
+	case messageHostUnconfirmedByClient:
+		return "host_unconfirmed_by_client"
+	case messageConfirmedByHost:
+		return "confirmed_by_host"
+	case messageSubdoc:
+		return "subdoc"
+	case messageSubdocClose:
+		return "subdoc_close"
+	case messagePermissionDenied:
+		return "permission_denied"
+	}
+	return "unknown"
+}
+
 type message interface {
 	ReadByte() (byte, error)
 	Read(p []byte) (int, error)
@@ -30,16 +72,20 @@ func (ydb *Ydb) readMessage(m message, session *session) (err error) {
 	}
 	switch messageType {
 	case messageAwareness:
-		debug("reading sub message")
+		ydb.log.Debug("reading awareness message", "room", session.roomname, "session", session.sessionid)
 		err = ydb.readSubMessage(m, session)
 	case messageSync:
-		debug("reading update message")
-		err = ydb.readUpdateMessage(m, session)
+		ydb.log.Debug("reading sync message", "room", session.roomname, "session", session.sessionid)
+		err = ydb.readUpdateMessage(m, session, session.roomname)
 	case messageConfirmation:
-		debug("reading conf message")
+		ydb.log.Debug("reading confirmation message", "room", session.roomname, "session", session.sessionid)
 		err = readConfirmationMessage(m, session)
+	case messageSubdoc:
+		err = ydb.readSubdocMessage(m, session)
+	case messageSubdocClose:
+		err = ydb.readSubdocClose(m, session)
 	default:
-		debug(fmt.Sprintf("received unknown message type %d", messageType))
+		ydb.log.Debug("received unknown message type", "room", session.roomname, "session", session.sessionid, "type", messageType)
 	}
 	return err
 }
@@ -125,6 +171,43 @@ const messageYjsSyncStep1 = 0
 const messageYjsSyncStep2 = 1
 const messageYjsUpdate = 2
 
+// createMessagePermissionDenied tells a client that its update was rejected.
+// The auth message of y-protocols can't be used: its type number is taken by
+// messageConfirmation, which the server sends as well.
+func createMessagePermissionDenied(reason string) []byte {
+	buf := &bytes.Buffer{}
+	writeUvarint(buf, messagePermissionDenied)
+	writeString(buf, reason)
+	return buf.Bytes()
+}
+
+// encodeSyncMessage builds [messageSync][syncType][len][payload].
+func encodeSyncMessage(syncType uint64, payload []byte) []byte {
+	buf := &bytes.Buffer{}
+	writeUvarint(buf, messageSync)
+	writeUvarint(buf, syncType)
+	writePayload(buf, payload)
+	return buf.Bytes()
+}
+
+// decodeSyncMessage is the inverse of encodeSyncMessage.
+func decodeSyncMessage(bs []byte) (syncType uint64, payload []byte, err error) {
+	buf := bytes.NewBuffer(bs)
+	messageType, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	if messageType != messageSync {
+		return 0, nil, fmt.Errorf("not a sync message: type=%d", messageType)
+	}
+	syncType, err = binary.ReadUvarint(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	payload, err = readPayload(buf)
+	return syncType, payload, err
+}
+
 func readStateVector(m message) []byte {
 	ssLength, _ := binary.ReadUvarint(m)
 	encoder := &bytes.Buffer{}
@@ -137,8 +220,11 @@ func readStateVector(m message) []byte {
 	return encoder.Bytes()
 }
 
-func (ydb *Ydb) readUpdateMessage(m message, session *session) error {
+// readUpdateMessage reads a sync message of the session for roomname, its
+// room or one of its subdocuments.
+func (ydb *Ydb) readUpdateMessage(m message, session *session, roomname YjsRoomName) error {
 	messageType, _ := binary.ReadUvarint(m)
+	maxMessageSize := ydb.config().MaxMessageSize
 
 	write := &bytes.Buffer{}
 
@@ -152,8 +238,8 @@ func (ydb *Ydb) readUpdateMessage(m message, session *session) error {
 		if err != nil {
 			return err
 		}
-		if ydb.cfg.MaxMessageSize > 0 && int64(len(payload)) > ydb.cfg.MaxMessageSize {
-			return fmt.Errorf("sync step1 payload exceeds max message size (%d > %d)", len(payload), ydb.cfg.MaxMessageSize)
+		if maxMessageSize > 0 && int64(len(payload)) > maxMessageSize {
+			return fmt.Errorf("sync step1 payload exceeds max message size (%d > %d)", len(payload), maxMessageSize)
 		}
 		if err := writeUvarint(write, messageYjsSyncStep1); err != nil {
 			return err
@@ -166,8 +252,8 @@ func (ydb *Ydb) readUpdateMessage(m message, session *session) error {
 		if err != nil {
 			return err
 		}
-		if ydb.cfg.MaxMessageSize > 0 && int64(len(payload)) > ydb.cfg.MaxMessageSize {
-			return fmt.Errorf("sync step2 payload exceeds max message size (%d > %d)", len(payload), ydb.cfg.MaxMessageSize)
+		if maxMessageSize > 0 && int64(len(payload)) > maxMessageSize {
+			return fmt.Errorf("sync step2 payload exceeds max message size (%d > %d)", len(payload), maxMessageSize)
 		}
 		if err := writeUvarint(write, messageYjsSyncStep2); err != nil {
 			return err
@@ -180,8 +266,8 @@ func (ydb *Ydb) readUpdateMessage(m message, session *session) error {
 		if err != nil {
 			return err
 		}
-		if ydb.cfg.MaxMessageSize > 0 && int64(len(payload)) > ydb.cfg.MaxMessageSize {
-			return fmt.Errorf("update payload exceeds max message size (%d > %d)", len(payload), ydb.cfg.MaxMessageSize)
+		if maxMessageSize > 0 && int64(len(payload)) > maxMessageSize {
+			return fmt.Errorf("update payload exceeds max message size (%d > %d)", len(payload), maxMessageSize)
 		}
 		if err := writeUvarint(write, messageYjsUpdate); err != nil {
 			return err
@@ -195,7 +281,7 @@ func (ydb *Ydb) readUpdateMessage(m message, session *session) error {
 		return nil
 	}
 
-	ydb.updateRoom(session.roomname, session, write.Bytes())
+	ydb.updateRoom(roomname, session, write.Bytes())
 	return nil
 }
 
@@ -0,0 +1,227 @@
+package ydb
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (in seconds) of the latency histograms.
+var latencyBuckets = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// counterVec is a set of counters partitioned by the value of one label.
+type counterVec struct {
+	mu     sync.RWMutex
+	values map[string]*uint64
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]*uint64)}
+}
+
+func (cv *counterVec) add(label string, n uint64) {
+	cv.mu.RLock()
+	v := cv.values[label]
+	cv.mu.RUnlock()
+	if v == nil {
+		cv.mu.Lock()
+		v = cv.values[label]
+		if v == nil {
+			v = new(uint64)
+			cv.values[label] = v
+		}
+		cv.mu.Unlock()
+	}
+	atomic.AddUint64(v, n)
+}
+
+func (cv *counterVec) snapshot() map[string]uint64 {
+	cv.mu.RLock()
+	defer cv.mu.RUnlock()
+	m := make(map[string]uint64, len(cv.values))
+	for label, v := range cv.values {
+		m[label] = atomic.LoadUint64(v)
+	}
+	return m
+}
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *histogram) observeSince(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+// metrics holds the instrumentation of a Ydb instance.
+type metrics struct {
+	messagesIn    *counterVec
+	bytesIn       *counterVec
+	messagesOut   *counterVec
+	bytesOut      *counterVec
+	updates       uint64
+	updatesFailed uint64
+	subscriptions uint64
+	reaperRuns    uint64
+	roomsReaped   uint64
+	storeAppend   *histogram
+	storeRead     *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		messagesIn:  newCounterVec(),
+		bytesIn:     newCounterVec(),
+		messagesOut: newCounterVec(),
+		bytesOut:    newCounterVec(),
+		storeAppend: newHistogram(latencyBuckets),
+		storeRead:   newHistogram(latencyBuckets),
+	}
+}
+
+func (m *metrics) messageIn(bs []byte) {
+	t := messageTypeName(bs)
+	m.messagesIn.add(t, 1)
+	m.bytesIn.add(t, uint64(len(bs)))
+}
+
+func (m *metrics) messageOut(bs []byte) {
+	t := messageTypeName(bs)
+	m.messagesOut.add(t, 1)
+	m.bytesOut.add(t, uint64(len(bs)))
+}
+
+// droppingBroadcaster is implemented by broadcasters that count messages they
+// had to discard for slow subscribers.
+type droppingBroadcaster interface {
+	Dropped() uint64
+}
+
+// MetricsHandler serves the metrics of the instance in the Prometheus text format.
+func (ydb *Ydb) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		ydb.writeMetrics(w)
+	})
+}
+
+func (ydb *Ydb) writeMetrics(w io.Writer) {
+	m := ydb.metrics
+
+	ydb.roomsMux.RLock()
+	rooms := len(ydb.rooms)
+	ydb.roomsMux.RUnlock()
+	writeMetric(w, "ydb_active_rooms", "gauge", "Rooms currently loaded in memory.", float64(rooms))
+
+	sessions, queued, maxQueued := ydb.sessionStats()
+	writeMetric(w, "ydb_active_sessions", "gauge", "Connected sessions.", float64(sessions))
+	writeMetric(w, "ydb_send_queue_depth", "gauge", "Messages waiting in session send queues.", float64(queued))
+	writeMetric(w, "ydb_send_queue_depth_max", "gauge", "Longest session send queue.", float64(maxQueued))
+
+	writeCounterVec(w, "ydb_messages_received_total", "Messages received from clients by message type.", m.messagesIn)
+	writeCounterVec(w, "ydb_bytes_received_total", "Bytes received from clients by message type.", m.bytesIn)
+	writeCounterVec(w, "ydb_messages_sent_total", "Messages queued for clients by message type.", m.messagesOut)
+	writeCounterVec(w, "ydb_bytes_sent_total", "Bytes queued for clients by message type.", m.bytesOut)
+
+	writeMetric(w, "ydb_updates_total", "counter", "Updates persisted to the store.", float64(atomic.LoadUint64(&m.updates)))
+	writeMetric(w, "ydb_updates_failed_total", "counter", "Updates that were rejected or failed to persist.", float64(atomic.LoadUint64(&m.updatesFailed)))
+	writeMetric(w, "ydb_subscriptions_total", "counter", "Sessions subscribed to a room.", float64(atomic.LoadUint64(&m.subscriptions)))
+	writeHistogram(w, "ydb_store_append_duration_seconds", "Latency of Store.Append.", m.storeAppend)
+	writeHistogram(w, "ydb_store_read_duration_seconds", "Latency of Store.ReadFrom.", m.storeRead)
+
+	writeMetric(w, "ydb_reaper_runs_total", "counter", "Runs of the idle room reaper.", float64(atomic.LoadUint64(&m.reaperRuns)))
+	writeMetric(w, "ydb_rooms_reaped_total", "counter", "Idle rooms removed by the reaper.", float64(atomic.LoadUint64(&m.roomsReaped)))
+
+	if db, ok := ydb.broadcaster.(droppingBroadcaster); ok {
+		writeMetric(w, "ydb_broadcaster_dropped_total", "counter", "Broadcast messages dropped for slow subscribers.", float64(db.Dropped()))
+	}
+	writeMetric(w, "ydb_events_dropped_total", "counter", "Lifecycle events dropped because the event queue was full.", float64(ydb.DroppedEvents()))
+
+	rl := ydb.RateLimitStats()
+	fmt.Fprintf(w, "# HELP ydb_rate_limit_breaches_total Messages exceeding a rate limit by scope.\n# TYPE ydb_rate_limit_breaches_total counter\n")
+	fmt.Fprintf(w, "ydb_rate_limit_breaches_total{scope=\"session\"} %d\n", rl.SessionBreaches)
+	fmt.Fprintf(w, "ydb_rate_limit_breaches_total{scope=\"room\"} %d\n", rl.RoomBreaches)
+	fmt.Fprintf(w, "ydb_rate_limit_breaches_total{scope=\"ip\"} %d\n", rl.IPBreaches)
+	fmt.Fprintf(w, "# HELP ydb_rate_limit_actions_total Actions taken on rate limited messages.\n# TYPE ydb_rate_limit_actions_total counter\n")
+	fmt.Fprintf(w, "ydb_rate_limit_actions_total{action=\"drop\"} %d\n", rl.Dropped)
+	fmt.Fprintf(w, "ydb_rate_limit_actions_total{action=\"delay\"} %d\n", rl.Delayed)
+	fmt.Fprintf(w, "ydb_rate_limit_actions_total{action=\"disconnect\"} %d\n", rl.Disconnected)
+}
+
+// sessionStats returns the number of sessions and the total and maximum length of their send queues.
+func (ydb *Ydb) sessionStats() (sessions int, queued int, maxQueued int) {
+	ydb.sessionsMux.Lock()
+	sessions = len(ydb.sessions)
+	ydb.sessionsMux.Unlock()
+	ydb.conns.Range(func(key, _ any) bool {
+		n := len(key.(*wsConn).send)
+		queued += n
+		if n > maxQueued {
+			maxQueued = n
+		}
+		return true
+	})
+	return sessions, queued, maxQueued
+}
+
+func writeMetric(w io.Writer, name, kind, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatMetricValue(v))
+}
+
+func writeCounterVec(w io.Writer, name, help string, cv *counterVec) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	values := cv.snapshot()
+	labels := make([]string, 0, len(values))
+	for label := range values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{type=%q} %d\n", name, label, values[label])
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, le := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatMetricValue(le), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatMetricValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
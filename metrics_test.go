@@ -0,0 +1,104 @@
+package ydb
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrapeMetrics(t *testing.T, ydbInstance *Ydb) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ydbInstance.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+
+	writer := ts.dial(t, "metrics-room")
+	reader := ts.dial(t, "metrics-room")
+	time.Sleep(100 * time.Millisecond)
+
+	writer.sendSyncUpdate([]byte("hello"))
+	if _, ok := reader.recv(2 * time.Second); !ok {
+		t.Fatal("reader timed out waiting for broadcast")
+	}
+
+	out := scrapeMetrics(t, ts.ydb)
+	msgLen := len(makeYjsSyncUpdate([]byte("hello")))
+	for _, want := range []string{
+		"# TYPE ydb_active_rooms gauge\nydb_active_rooms 1\n",
+		"ydb_active_sessions 2\n",
+		"ydb_messages_received_total{type=\"update\"} 1\n",
+		"ydb_bytes_received_total{type=\"update\"} " + strconv.Itoa(msgLen) + "\n",
+		"ydb_messages_sent_total{type=\"update\"} 1\n",
+		"ydb_updates_total 1\n",
+		"ydb_subscriptions_total 2\n",
+		"ydb_store_append_duration_seconds_count 1\n",
+		"ydb_store_read_duration_seconds_count 2\n",
+		"ydb_broadcaster_dropped_total 0\n",
+		"ydb_rate_limit_actions_total{action=\"drop\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("metrics output:\n%s", out)
+	}
+}
+
+func TestMetricsReaperAndDrops(t *testing.T) {
+	broadcaster := NewLocalBroadcaster(1)
+	cfg := Config{
+		SendBufferSize:   256,
+		MaxMessageSize:   10 * 1024 * 1024,
+		MaxRoomSize:      50 * 1024 * 1024,
+		BroadcastBuffer:  1,
+		RoomIdleTimeout:  20 * time.Millisecond,
+		RoomReapInterval: 10 * time.Millisecond,
+	}
+	ydbInstance := InitYdb(newMemoryStore(), broadcaster, cfg)
+	defer ydbInstance.Close()
+
+	broadcaster.Subscribe("drops", 1)
+	broadcaster.Publish("drops", 2, []byte("a"))
+	broadcaster.Publish("drops", 2, []byte("b"))
+	ydbInstance.getOrCreateRoom("reaped")
+
+	waitFor(t, time.Second, func() bool {
+		return strings.Contains(scrapeMetrics(t, ydbInstance), "ydb_rooms_reaped_total 1\n")
+	})
+	out := scrapeMetrics(t, ydbInstance)
+	if !strings.Contains(out, "ydb_broadcaster_dropped_total 1\n") {
+		t.Fatalf("expected one dropped broadcast, got:\n%s", out)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(5)
+
+	var buf bytes.Buffer
+	writeHistogram(&buf, "test_seconds", "Test.", h)
+	want := "# HELP test_seconds Test.\n# TYPE test_seconds histogram\n" +
+		"test_seconds_bucket{le=\"0.1\"} 1\n" +
+		"test_seconds_bucket{le=\"1\"} 2\n" +
+		"test_seconds_bucket{le=\"+Inf\"} 3\n" +
+		"test_seconds_sum 5.55\n" +
+		"test_seconds_count 3\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected histogram output:\n%s", buf.String())
+	}
+}
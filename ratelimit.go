@@ -0,0 +1,337 @@
+package ydb
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit configures a pair of token buckets. A zero rate disables the
+// corresponding bucket; a zero burst allows one second worth of tokens.
+type RateLimit struct {
+	MessagesPerSecond float64
+	BytesPerSecond    float64
+	MessageBurst      int
+	ByteBurst         int
+}
+
+func (rl RateLimit) enabled() bool {
+	return rl.MessagesPerSecond > 0 || rl.BytesPerSecond > 0
+}
+
+// RateLimitAction decides what happens to a message that exceeds a rate limit.
+type RateLimitAction int
+
+const (
+	// RateLimitDrop discards the message.
+	RateLimitDrop RateLimitAction = iota
+	// RateLimitDelay discards the message and holds back the session until
+	// the limit would have let it pass, discarding its messages until then.
+	RateLimitDelay
+	// RateLimitDisconnect closes the connection with CloseRateLimited.
+	RateLimitDisconnect
+)
+
+var rateLimitActionNames = []string{"drop", "delay", "disconnect"}
+
+func (a RateLimitAction) String() string {
+	if a >= 0 && int(a) < len(rateLimitActionNames) {
+		return rateLimitActionNames[a]
+	}
+	return fmt.Sprintf("RateLimitAction(%d)", int(a))
+}
+
+func (a RateLimitAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses "drop", "delay" or "disconnect".
+func (a *RateLimitAction) UnmarshalText(text []byte) error {
+	for i, name := range rateLimitActionNames {
+		if strings.EqualFold(string(text), name) {
+			*a = RateLimitAction(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rate limit action %q (want drop, delay or disconnect)", text)
+}
+
+// RateLimitStats counts rate limit breaches by scope and by the action taken.
+type RateLimitStats struct {
+	SessionBreaches uint64
+	RoomBreaches    uint64
+	IPBreaches      uint64
+	Dropped         uint64
+	Delayed         uint64
+	Disconnected    uint64
+}
+
+type rateLimitScope int
+
+const (
+	scopeSession rateLimitScope = iota
+	scopeRoom
+	scopeIP
+)
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// cost caps n at the burst size, so oversized messages can still pass a full bucket.
+func (b *tokenBucket) cost(n int) float64 {
+	c := float64(n)
+	if c > b.burst {
+		c = b.burst
+	}
+	return c
+}
+
+// rateLimiter limits messages and bytes for one session, room or remote IP.
+type rateLimiter struct {
+	mu       sync.Mutex
+	scope    rateLimitScope
+	limit    RateLimit
+	messages *tokenBucket
+	bytes    *tokenBucket
+	lastUsed time.Time
+}
+
+func newRateLimiter(scope rateLimitScope, rl RateLimit, now time.Time) *rateLimiter {
+	if !rl.enabled() {
+		return nil
+	}
+	return &rateLimiter{
+		scope:    scope,
+		limit:    rl,
+		messages: newTokenBucket(rl.MessagesPerSecond, rl.MessageBurst, now),
+		bytes:    newTokenBucket(rl.BytesPerSecond, rl.ByteBurst, now),
+		lastUsed: now,
+	}
+}
+
+// take consumes tokens for one message of size n if both buckets allow it.
+func (l *rateLimiter) take(n int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastUsed = now
+	if l.messages != nil {
+		l.messages.refill(now)
+		if l.messages.tokens < 1 {
+			return false
+		}
+	}
+	if l.bytes != nil {
+		l.bytes.refill(now)
+		if l.bytes.tokens < l.bytes.cost(n) {
+			return false
+		}
+		l.bytes.tokens -= l.bytes.cost(n)
+	}
+	if l.messages != nil {
+		l.messages.tokens--
+	}
+	return true
+}
+
+func (l *rateLimiter) refund(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.messages != nil {
+		l.messages.tokens++
+	}
+	if l.bytes != nil {
+		l.bytes.tokens += l.bytes.cost(n)
+	}
+}
+
+// holdBack returns how long it takes until the buckets have the tokens for
+// one message of size n.
+func (l *rateLimiter) holdBack(n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	if l.messages != nil {
+		l.messages.refill(now)
+		if missing := 1 - l.messages.tokens; missing > 0 {
+			wait = time.Duration(missing / l.messages.rate * float64(time.Second))
+		}
+	}
+	if l.bytes != nil {
+		l.bytes.refill(now)
+		if missing := l.bytes.cost(n) - l.bytes.tokens; missing > 0 {
+			if w := time.Duration(missing / l.bytes.rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	return wait
+}
+
+func (l *rateLimiter) idleSince(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.lastUsed)
+}
+
+type rateLimitCounters struct {
+	breaches     [3]uint64
+	dropped      uint64
+	delayed      uint64
+	disconnected uint64
+}
+
+// RateLimitStats returns the rate limit counters since the instance was created.
+func (ydb *Ydb) RateLimitStats() RateLimitStats {
+	c := &ydb.rateLimits
+	return RateLimitStats{
+		SessionBreaches: atomic.LoadUint64(&c.breaches[scopeSession]),
+		RoomBreaches:    atomic.LoadUint64(&c.breaches[scopeRoom]),
+		IPBreaches:      atomic.LoadUint64(&c.breaches[scopeIP]),
+		Dropped:         atomic.LoadUint64(&c.dropped),
+		Delayed:         atomic.LoadUint64(&c.delayed),
+		Disconnected:    atomic.LoadUint64(&c.disconnected),
+	}
+}
+
+// outdated reports whether l has to be rebuilt for the limit rl, which
+// happens after UpdateConfig changed it.
+func (l *rateLimiter) outdated(rl RateLimit) bool {
+	return l == nil || l.limit != rl
+}
+
+// sessionRateLimiter is only called from the read pump of the connection.
+func (wsConn *wsConn) sessionRateLimiter() *rateLimiter {
+	rl := wsConn.ydb.config().SessionRateLimit
+	if !rl.enabled() {
+		return nil
+	}
+	if wsConn.limiter.outdated(rl) {
+		wsConn.limiter = newRateLimiter(scopeSession, rl, time.Now())
+	}
+	return wsConn.limiter
+}
+
+func (ydb *Ydb) roomRateLimiter(name YjsRoomName) *rateLimiter {
+	rl := ydb.config().RoomRateLimit
+	if !rl.enabled() {
+		return nil
+	}
+	r := ydb.getOrCreateRoom(name)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.limiter.outdated(rl) {
+		r.limiter = newRateLimiter(scopeRoom, rl, time.Now())
+	}
+	return r.limiter
+}
+
+func (ydb *Ydb) ipRateLimiter(remoteAddr string) *rateLimiter {
+	rl := ydb.config().IPRateLimit
+	if !rl.enabled() || remoteAddr == "" {
+		return nil
+	}
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	ydb.ipLimitersMux.Lock()
+	defer ydb.ipLimitersMux.Unlock()
+	l := ydb.ipLimiters[ip]
+	if l.outdated(rl) {
+		l = newRateLimiter(scopeIP, rl, time.Now())
+		ydb.ipLimiters[ip] = l
+	}
+	return l
+}
+
+// reapIPRateLimiters forgets limiters of addresses that have been quiet for a while.
+func (ydb *Ydb) reapIPRateLimiters() {
+	now := time.Now()
+	idleTimeout := ydb.config().RoomIdleTimeout
+	ydb.ipLimitersMux.Lock()
+	for ip, l := range ydb.ipLimiters {
+		if l.idleSince(now) > idleTimeout {
+			delete(ydb.ipLimiters, ip)
+		}
+	}
+	ydb.ipLimitersMux.Unlock()
+}
+
+// admitMessage applies the session, room and IP limits to an incoming message of
+// the given size. It returns false if the message must not be processed.
+func (wsConn *wsConn) admitMessage(size int) bool {
+	ydb := wsConn.ydb
+	action := ydb.config().RateLimitAction
+	var limiters []*rateLimiter
+	for _, l := range []*rateLimiter{
+		wsConn.sessionRateLimiter(),
+		ydb.roomRateLimiter(wsConn.session.roomname),
+		ydb.ipRateLimiter(wsConn.session.remoteAddr),
+	} {
+		if l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	if len(limiters) == 0 {
+		return true
+	}
+
+	// The read pump must keep reading, or pongs would go unanswered, so
+	// messages over a limit are never waited for. A held back session pays
+	// for its own excess, without taking tokens others could use
+	now := time.Now()
+	counters := &ydb.rateLimits
+	if action == RateLimitDelay && now.Before(wsConn.heldUntil) {
+		atomic.AddUint64(&counters.delayed, 1)
+		return false
+	}
+	for i, l := range limiters {
+		if l.take(size, now) {
+			continue
+		}
+		for _, prev := range limiters[:i] {
+			prev.refund(size)
+		}
+		atomic.AddUint64(&counters.breaches[l.scope], 1)
+		switch action {
+		case RateLimitDisconnect:
+			atomic.AddUint64(&counters.disconnected, 1)
+			wsConn.Close(CloseRateLimited, "rate limit exceeded")
+		case RateLimitDelay:
+			atomic.AddUint64(&counters.delayed, 1)
+			wsConn.heldUntil = now.Add(l.holdBack(size, now))
+		default:
+			atomic.AddUint64(&counters.dropped, 1)
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package ydb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func rateLimitTestConfig() Config {
+	return Config{
+		SendBufferSize:   256,
+		MaxMessageSize:   10 * 1024 * 1024,
+		MaxRoomSize:      50 * 1024 * 1024,
+		BroadcastBuffer:  64,
+		RoomIdleTimeout:  time.Minute,
+		RoomReapInterval: time.Minute,
+	}
+}
+
+func countStoredMessages(t *testing.T, store Store, room YjsRoomName) int {
+	t.Helper()
+	return len(storedSyncPayloads(t, store, room))
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(scopeSession, RateLimit{MessagesPerSecond: 2, BytesPerSecond: 100}, now)
+
+	if !l.take(10, now) || !l.take(10, now) {
+		t.Fatal("expected burst of two messages to pass")
+	}
+	if l.take(10, now) {
+		t.Fatal("expected third message to be limited")
+	}
+	if !l.take(10, now.Add(500*time.Millisecond)) {
+		t.Fatal("expected a token after refill")
+	}
+
+	l = newRateLimiter(scopeSession, RateLimit{BytesPerSecond: 100}, now)
+	if !l.take(80, now) || l.take(80, now) {
+		t.Fatal("expected byte bucket to allow 80 bytes once")
+	}
+	if w := l.holdBack(100, now); w < 700*time.Millisecond || w > time.Second {
+		t.Fatalf("unexpected hold back %v", w)
+	}
+	if l.take(100, now) {
+		t.Fatal("hold back must not take tokens")
+	}
+
+	if newRateLimiter(scopeSession, RateLimit{}, now) != nil {
+		t.Fatal("zero rate limit should disable the limiter")
+	}
+}
+
+func TestRateLimitSessionDrop(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.SessionRateLimit = RateLimit{MessagesPerSecond: 0.1, MessageBurst: 2}
+	ts := newTestServerWithConfig(t, cfg)
+
+	c := ts.dial(t, "flood")
+	for i := 0; i < 5; i++ {
+		c.sendSyncUpdate([]byte("spam"))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		return ts.ydb.RateLimitStats().Dropped == 3
+	})
+	if n := countStoredMessages(t, ts.store, "flood"); n != 2 {
+		t.Fatalf("expected 2 stored messages, got %d", n)
+	}
+	if stats := ts.ydb.RateLimitStats(); stats.SessionBreaches != 3 {
+		t.Fatalf("expected 3 session breaches, got %+v", stats)
+	}
+}
+
+func TestRateLimitRoomAcrossSessions(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.RoomRateLimit = RateLimit{MessagesPerSecond: 0.1, MessageBurst: 1}
+	ts := newTestServerWithConfig(t, cfg)
+
+	a := ts.dial(t, "shared")
+	b := ts.dial(t, "shared")
+	a.sendSyncUpdate([]byte("first"))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("shared")
+		return size > 0
+	})
+	b.sendSyncUpdate([]byte("second"))
+	waitFor(t, 2*time.Second, func() bool {
+		return ts.ydb.RateLimitStats().RoomBreaches == 1
+	})
+	if n := countStoredMessages(t, ts.store, "shared"); n != 1 {
+		t.Fatalf("expected room limit to allow one message, got %d", n)
+	}
+}
+
+func TestRateLimitIPAcrossRooms(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.IPRateLimit = RateLimit{BytesPerSecond: 1, ByteBurst: 20}
+	ts := newTestServerWithConfig(t, cfg)
+
+	a := ts.dial(t, "ip-a")
+	b := ts.dial(t, "ip-b")
+	a.sendSyncUpdate([]byte("0123456789"))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("ip-a")
+		return size > 0
+	})
+	b.sendSyncUpdate([]byte("0123456789"))
+	waitFor(t, 2*time.Second, func() bool {
+		return ts.ydb.RateLimitStats().IPBreaches == 1
+	})
+	if size, _ := ts.store.Size("ip-b"); size != 0 {
+		t.Fatalf("expected IP limit to drop second room's update, size=%d", size)
+	}
+}
+
+func TestRateLimitDisconnect(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.SessionRateLimit = RateLimit{MessagesPerSecond: 0.1, MessageBurst: 1}
+	cfg.RateLimitAction = RateLimitDisconnect
+	ts := newTestServerWithConfig(t, cfg)
+
+	c := ts.dial(t, "kick")
+	c.sendSyncUpdate([]byte("one"))
+	c.sendSyncUpdate([]byte("two"))
+
+	err, ok := c.waitClosed(2 * time.Second)
+	if !ok {
+		t.Fatal("client was not disconnected")
+	}
+	if !websocket.IsCloseError(err, CloseRateLimited) {
+		t.Fatalf("expected close code %d, got %v", CloseRateLimited, err)
+	}
+	if stats := ts.ydb.RateLimitStats(); stats.Disconnected != 1 {
+		t.Fatalf("expected one disconnect, got %+v", stats)
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.SessionRateLimit = RateLimit{MessagesPerSecond: 4, MessageBurst: 1}
+	cfg.RateLimitAction = RateLimitDelay
+	ts := newTestServerWithConfig(t, cfg)
+
+	c := ts.dial(t, "slowed")
+	for i := 0; i < 4; i++ {
+		c.sendSyncUpdate([]byte("tick"))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		return ts.ydb.RateLimitStats().Delayed == 3
+	})
+	if n := countStoredMessages(t, ts.store, "slowed"); n != 1 {
+		t.Fatalf("expected messages of the held back session to be dropped, %d stored", n)
+	}
+	if stats := ts.ydb.RateLimitStats(); stats.SessionBreaches != 1 || stats.Dropped != 0 {
+		t.Fatalf("expected one breach holding back the session, got %+v", stats)
+	}
+
+	// Once the session has waited, it may send again
+	time.Sleep(300 * time.Millisecond)
+	c.sendSyncUpdate([]byte("tock"))
+	waitFor(t, 2*time.Second, func() bool {
+		return countStoredMessages(t, ts.store, "slowed") == 2
+	})
+}
+
+func TestRateLimitDelayHoldsBackOnlyTheSender(t *testing.T) {
+	cfg := rateLimitTestConfig()
+	cfg.RoomRateLimit = RateLimit{MessagesPerSecond: 4, MessageBurst: 1}
+	cfg.RateLimitAction = RateLimitDelay
+	ts := newTestServerWithConfig(t, cfg)
+
+	flood := ts.dial(t, "shared")
+	quiet := ts.dial(t, "shared")
+	for i := 0; i < 20; i++ {
+		flood.sendSyncUpdate([]byte("spam"))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		return ts.ydb.RateLimitStats().Delayed == 19
+	})
+	// The flood left no debt in the room for others to pay
+	time.Sleep(300 * time.Millisecond)
+	quiet.sendSyncUpdate([]byte("hello"))
+	waitFor(t, 2*time.Second, func() bool {
+		return countStoredMessages(t, ts.store, "shared") == 2
+	})
+	if stats := ts.ydb.RateLimitStats(); stats.RoomBreaches != 1 || stats.Delayed != 19 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,159 @@
+package ydb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// offsetHeader carries the byte offset of the end of a room's log.
+const offsetHeader = "Ydb-Offset"
+
+type restHandler struct {
+	roomHandler
+}
+
+// NewRestHandler serves the content of rooms over plain HTTP, for clients that
+// don't speak the websocket protocol. Rooms are resolved as by NewWsHandler;
+// with WithRoomPathPrefix("/rooms/"):
+//
+//	GET  /rooms/{room}                      the room merged into one Yjs update
+//	GET  /rooms/{room}?format=state-vector  the Yjs state vector of the room
+//	GET  /rooms/{room}?format=json          the room as rendered by Doc.ToJSON
+//	HEAD /rooms/{room}                      only the ETag and Ydb-Offset headers
+//	POST /rooms/{room}                      apply the Yjs update in the body
+//
+// Responses carry the offset of the room's log as ETag and in the Ydb-Offset
+// header. GET and HEAD honour If-None-Match; POST honours If-Match, which is
+// checked before the update is written and therefore doesn't exclude
+// concurrent writers.
+//
+// Requests are authorized like websocket sessions: WithReadOnlySession forbids
+// POST, and updates pass the interceptors with the WithPrincipal principal
+// before they are persisted and broadcast to connected clients.
+func NewRestHandler(ydbInstance *Ydb, opts ...HandlerOption) http.Handler {
+	return &restHandler{newRoomHandler(ydbInstance, opts)}
+}
+
+func (h *restHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	room, ok := h.room(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPost {
+		h.post(w, r, room)
+		return
+	}
+	data, offset, err := h.ydb.store.ReadFrom(room, 0)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	etag := offsetETag(offset)
+	w.Header().Set("ETag", etag)
+	w.Header().Set(offsetHeader, strconv.FormatUint(uint64(offset), 10))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	doc, err := docFromLog(data)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	var body []byte
+	contentType := "application/octet-stream"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "update":
+		body, err = doc.EncodeStateAsUpdate(nil)
+	case "state-vector":
+		body = doc.EncodeStateVector()
+	case "json":
+		buf := &bytes.Buffer{}
+		err = writeJSON(buf, doc.ToJSON(), "")
+		body = buf.Bytes()
+		contentType = "application/json"
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+func (h *restHandler) post(w http.ResponseWriter, r *http.Request, room YjsRoomName) {
+	if isReadOnlySession(r.Context()) {
+		http.Error(w, "read-only access", http.StatusForbidden)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		offset, err := h.ydb.store.Size(room)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		if !etagMatches(ifMatch, offsetETag(offset)) {
+			w.Header().Set("ETag", offsetETag(offset))
+			http.Error(w, "room has changed", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	body := io.Reader(r.Body)
+	if maxSize := h.ydb.config().MaxMessageSize; maxSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	update, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := NewDoc().ApplyUpdate(update); err != nil {
+		writeHTTPError(w, fmt.Errorf("%w: %v", ErrInvalidUpdate, err))
+		return
+	}
+	// A session without connection, so that interceptors and events see who wrote the update
+	session := newSession(h.ydb.genUint64(), string(room))
+	session.principal = principalFromContext(r.Context())
+	if session.principal == "" {
+		session.principal = clientCertPrincipal(r)
+	}
+	session.remoteAddr = r.RemoteAddr
+	if err := h.ydb.updateRoom(room, session, encodeSyncMessage(messageYjsUpdate, update)); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func offsetETag(offset uint32) string {
+	return `"` + strconv.FormatUint(uint64(offset), 10) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
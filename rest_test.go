@@ -0,0 +1,120 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func restRequest(t *testing.T, method, url string, body []byte, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestRestGetAndPost(t *testing.T) {
+	ts := newTestServer(t)
+	url := ts.httpServer.URL + "/rest/team/notes"
+	client := ts.dialPath(t, "/tree/", "team/notes")
+	client.sendSyncStep1([]byte{0})
+	client.recvAll(200 * time.Millisecond)
+
+	update := testUpdate([]testItem{{client: 1, root: "text", text: "abc"}})
+	if resp, body := restRequest(t, "POST", url, update, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST status %d: %s", resp.StatusCode, body)
+	}
+	msg, ok := client.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("expected the update to be broadcast to the websocket session")
+	}
+	if _, payload, err := parseSyncMessage(msg); err != nil || !bytes.Equal(payload, update) {
+		t.Fatalf("unexpected broadcast %v (%v)", msg, err)
+	}
+
+	resp, body := restRequest(t, "GET", url, nil, nil)
+	if resp.StatusCode != http.StatusOK || testText(applyAll(t, body), "text") != "abc" {
+		t.Fatalf("GET status %d, body %v", resp.StatusCode, body)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Ydb-Offset") == "" || etag != `"`+resp.Header.Get("Ydb-Offset")+`"` {
+		t.Fatalf("unexpected headers %v", resp.Header)
+	}
+
+	resp, body = restRequest(t, "GET", url+"?format=state-vector", nil, nil)
+	if sv, err := decodeStateVector(body); resp.StatusCode != http.StatusOK || err != nil || sv[1] != 3 {
+		t.Fatalf("unexpected state vector %v (%v)", body, err)
+	}
+
+	resp, body = restRequest(t, "HEAD", url, nil, nil)
+	if resp.StatusCode != http.StatusOK || len(body) != 0 || resp.Header.Get("ETag") != etag {
+		t.Fatalf("HEAD status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	if resp, _ = restRequest(t, "GET", url, nil, http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+
+	next := testUpdate([]testItem{{client: 1, clock: 3, origin: &yID{1, 2}, text: "d"}})
+	if resp, _ = restRequest(t, "POST", url, next, http.Header{"If-Match": {etag}}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("conditional POST status %d", resp.StatusCode)
+	}
+	if resp, _ = restRequest(t, "POST", url, next, http.Header{"If-Match": {etag}}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d", resp.StatusCode)
+	}
+	if resp, _ = restRequest(t, "GET", url, nil, http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after the room changed, got %d", resp.StatusCode)
+	}
+}
+
+func TestRestRejectsWrites(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Interceptors = []UpdateInterceptor{UpdateInterceptorFunc(func(u *Update) error {
+		if u.Room == "locked" {
+			return errors.New("locked")
+		}
+		return nil
+	})}
+	ts := newTestServerWithConfig(t, cfg)
+	update := testUpdate([]testItem{{client: 1, root: "text", text: "abc"}})
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		status int
+	}{
+		{"read-only", "POST", "/rest-readonly/room", update, http.StatusForbidden},
+		{"read-only get", "GET", "/rest-readonly/room", nil, http.StatusOK},
+		{"interceptor", "POST", "/rest/locked", update, http.StatusForbidden},
+		{"invalid update", "POST", "/rest/room", []byte{1, 2, 3}, http.StatusBadRequest},
+		{"invalid room", "GET", "/rest/.hidden", nil, http.StatusBadRequest},
+		{"unknown format", "GET", "/rest/room?format=xml", nil, http.StatusBadRequest},
+		{"method", "DELETE", "/rest/room", nil, http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, body := restRequest(t, c.method, ts.httpServer.URL+c.path, c.body, nil)
+			if resp.StatusCode != c.status {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, c.status, body)
+			}
+		})
+	}
+	if size, _ := ts.store.Size("locked"); size != 0 {
+		t.Fatal("rejected update was persisted")
+	}
+}
@@ -2,7 +2,8 @@ package ydb
 
 import (
 	"bytes"
-	"log"
+	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +17,10 @@ type room struct {
 	lastActive    time.Time
 	subCount      int32
 	roomsessionid uint32
+	limiter       *rateLimiter
+	// updates and bytes persisted since the room was loaded
+	updates uint64
+	bytes   uint64
 }
 
 func (ydb *Ydb) newRoom() *room {
@@ -26,34 +31,90 @@ func (ydb *Ydb) newRoom() *room {
 }
 
 // updateRoom persists data to store, updates room offset, and broadcasts to subscribers.
-func (ydb *Ydb) updateRoom(roomname YjsRoomName, session *session, bs []byte) {
+// session is nil for updates that don't come from a client.
+func (ydb *Ydb) updateRoom(roomname YjsRoomName, session *session, bs []byte) error {
+	return ydb.updateRoomIf(roomname, session, bs, nil)
+}
+
+// updateRoomIf is updateRoom, but only appends if check, when not nil,
+// returns no error right before the write. Other writes wait for check.
+func (ydb *Ydb) updateRoomIf(roomname YjsRoomName, session *session, bs []byte, check func() error) (err error) {
+	defer func() {
+		if err != nil {
+			atomic.AddUint64(&ydb.metrics.updatesFailed, 1)
+		} else {
+			atomic.AddUint64(&ydb.metrics.updates, 1)
+		}
+	}()
+
+	sessionid := session.info().ID
+
+	intercepted, err := ydb.interceptUpdate(roomname, session, bs)
+	if err != nil {
+		ydb.log.Info("update rejected", "room", roomname, "session", sessionid, "size", len(bs), "error", err)
+		if rejected, ok := err.(*UpdateRejectedError); ok && session != nil {
+			session.sendPermissionDenied(rejected.Reason)
+		}
+		return err
+	}
+	bs = intercepted
+
 	// Frame data for storage
 	pendingWrite := &bytes.Buffer{}
-	err := writePayload(pendingWrite, bs)
+	err = writePayload(pendingWrite, bs)
 	if err != nil {
-		log.Printf("Failed to create payload: %v", err)
-		return
+		ydb.log.Error("failed to frame update", "room", roomname, "session", sessionid, "error", err)
+		return err
 	}
 
-	// Enforce max room size at core level (protects all Store implementations)
-	if ydb.cfg.MaxRoomSize > 0 {
+	// Persist outside room mutex; the write lock keeps appends and their
+	// audit records in the same order
+	writeLock := ydb.writeLock(roomname)
+	writeLock.Lock()
+	// Enforce max room size at core level (protects all Store implementations).
+	// Checked under the write lock, so that concurrent writes can't each pass
+	// with the same size
+	if maxRoomSize := ydb.config().MaxRoomSize; maxRoomSize > 0 {
 		currentSize, err := ydb.store.Size(roomname)
 		if err != nil {
-			log.Printf("Failed to check room size: %v", err)
-			return
+			writeLock.Unlock()
+			ydb.log.Error("failed to check room size", "room", roomname, "error", err)
+			return err
 		}
-		if currentSize+uint32(pendingWrite.Len()) > ydb.cfg.MaxRoomSize {
-			log.Printf("Room %s would exceed max size %d (current: %d, write: %d)", roomname, ydb.cfg.MaxRoomSize, currentSize, pendingWrite.Len())
-			return
+		if currentSize+uint32(pendingWrite.Len()) > maxRoomSize {
+			writeLock.Unlock()
+			ydb.log.Warn("room would exceed max size",
+				"room", roomname,
+				"session", sessionid,
+				"max", maxRoomSize,
+				"current", currentSize,
+				"size", pendingWrite.Len())
+			return ErrRoomTooLarge
 		}
 	}
-
-	// Persist outside room mutex — per-room store mutex handles concurrency
+	if check != nil {
+		if err := check(); err != nil {
+			writeLock.Unlock()
+			return err
+		}
+	}
+	appendStart := time.Now()
 	newOffset, err := ydb.store.Append(roomname, pendingWrite.Bytes())
+	ydb.metrics.storeAppend.observeSince(appendStart)
 	if err != nil {
-		log.Printf("Failed to append to store: %v", err)
-		return
+		writeLock.Unlock()
+		ydb.log.Error("failed to append to store", "room", roomname, "session", sessionid, "size", pendingWrite.Len(), "error", err)
+		return err
+	}
+	// The update is in the log at this point, so it is passed on even if it
+	// couldn't be audited; the error is returned once it was
+	auditErr := ydb.auditUpdate(roomname, pendingWrite.Bytes(), newOffset)
+	writeLock.Unlock()
+	if auditErr != nil {
+		ydb.log.Error("failed to audit update", "room", roomname, "session", sessionid, "offset", newOffset, "error", auditErr)
+		auditErr = fmt.Errorf("update written but not audited: %w", auditErr)
 	}
+	ydb.journalUpdate(roomname, session, newOffset, pendingWrite.Len())
 
 	// Update cached offset under room mutex (fast, no I/O)
 	r := ydb.getOrCreateRoom(roomname)
@@ -61,32 +122,58 @@ func (ydb *Ydb) updateRoom(roomname YjsRoomName, session *session, bs []byte) {
 	r.offset = newOffset
 	r.lastActive = time.Now()
 	r.mux.Unlock()
+	atomic.AddUint64(&r.updates, 1)
+	atomic.AddUint64(&r.bytes, uint64(len(bs)))
 
 	// Fan out to other subscribers
-	ydb.broadcaster.Publish(roomname, session.sessionid, bs)
+	ydb.broadcaster.Publish(roomname, sessionid, bs)
+
+	ev := UpdateEvent{Room: roomname, Session: session.info(), Size: len(bs), Offset: newOffset, Time: time.Now()}
+	if webhooks := ydb.config().Webhooks; webhooks != nil {
+		webhooks.update(ev)
+	}
+	if ydb.events != nil {
+		ydb.emit(func(h EventHandler) { h.OnUpdate(ev) })
+	}
+	return auditErr
 }
 
 // subscribeRoom subscribes a session to a room, catching up from the store first.
 func (ydb *Ydb) subscribeRoom(session *session, offset uint32) {
 	roomname := session.roomname
+	ydb.subscribe(session, roomname, offset, func(data []byte) {
+		session.sendUpdate(roomname, data, 0)
+	})
+}
 
+// subscribe passes the log of a room from offset, and then the messages
+// broadcast to it, to send. The session is subscribed to the session's room or
+// to one of its subdocuments.
+func (ydb *Ydb) subscribe(session *session, roomname YjsRoomName, offset uint32, send func(data []byte)) error {
 	// Subscribe first — starts buffering broadcast messages immediately
 	broadcastCh, err := ydb.broadcaster.Subscribe(roomname, session.sessionid)
 	if err != nil {
-		log.Printf("Failed to subscribe to broadcaster: %v", err)
-		return
+		ydb.log.Error("failed to subscribe to broadcaster", "room", roomname, "session", session.sessionid, "error", err)
+		return err
 	}
 
 	r := ydb.getOrCreateRoom(roomname)
 	atomic.AddInt32(&r.subCount, 1)
+	atomic.AddUint64(&ydb.metrics.subscriptions, 1)
 	r.mux.Lock()
 	r.lastActive = time.Now()
 	r.mux.Unlock()
+	// Subdocuments are part of the session of their root room
+	if roomname == session.roomname {
+		ydb.emitSessionEvent(session, EventHandler.OnSessionJoined)
+	}
 
 	// Catch-up from store
-	data, currentOffset, err := ydb.store.ReadFrom(roomname, offset)
+	readStart := time.Now()
+	data, _, err := ydb.store.ReadFrom(roomname, offset)
+	ydb.metrics.storeRead.observeSince(readStart)
 	if err != nil {
-		log.Printf("Failed to read from store for room %s: %v", roomname, err)
+		ydb.log.Error("failed to read from store", "room", roomname, "session", session.sessionid, "offset", offset, "error", err)
 	}
 
 	if len(data) > 0 {
@@ -96,16 +183,122 @@ func (ydb *Ydb) subscribeRoom(session *session, offset uint32) {
 			if err != nil {
 				break
 			}
-			session.sendUpdate(roomname, payload, uint64(currentOffset))
+			send(payload)
 		}
 	}
 
 	// Forward broadcast messages to session
 	go func() {
 		for msg := range broadcastCh {
-			session.sendUpdate(roomname, msg, 0)
+			send(msg)
 		}
 		// Channel closed — unsubscribed
-		atomic.AddInt32(&r.subCount, -1)
+		if atomic.AddInt32(&r.subCount, -1) == 0 {
+			ydb.emitRoomEvent(roomname, EventHandler.OnRoomIdle)
+		}
 	}()
+	return nil
+}
+
+// DeleteRoom disconnects every session of the room with CloseRoomDeleted and
+// removes its persisted data. The Store must implement RoomManager.
+func (ydb *Ydb) DeleteRoom(name YjsRoomName) error {
+	rm, ok := ydb.store.(RoomManager)
+	if !ok {
+		return ErrNotSupported
+	}
+	ydb.evictRoom(name, CloseRoomDeleted, "room deleted")
+	// Don't remove the log in the middle of an append and its audit record
+	writeLock := ydb.writeLock(name)
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	return rm.Delete(name)
+}
+
+// RenameRoom moves the persisted data of a room to a new name. Live sessions are
+// disconnected with CloseRoomRenamed and the new name as close reason, so clients
+// can reconnect to it. The Store must implement RoomManager.
+func (ydb *Ydb) RenameRoom(from, to YjsRoomName) error {
+	rm, ok := ydb.store.(RoomManager)
+	if !ok {
+		return ErrNotSupported
+	}
+	if from == to {
+		return nil
+	}
+	// Refuse early so sessions aren't dropped for a rename that can't happen
+	if err := ydb.checkRoomFree(to); err != nil {
+		return err
+	}
+	ydb.evictRoom(from, CloseRoomRenamed, string(to))
+	unlock := ydb.lockRoomPair(from, to)
+	defer unlock()
+	// A write may have created the room since
+	if err := ydb.checkRoomFree(to); err != nil {
+		return err
+	}
+	return rm.Rename(from, to)
+}
+
+// checkRoomFree returns ErrRoomExists if the room has content.
+func (ydb *Ydb) checkRoomFree(name YjsRoomName) error {
+	size, err := ydb.store.Size(name)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		return ErrRoomExists
+	}
+	return nil
+}
+
+// evictRoom closes all sessions bound to a room, drops their broadcaster
+// subscriptions, closes the room where sessions opened it as a subdocument and
+// forgets the cached room state.
+func (ydb *Ydb) evictRoom(name YjsRoomName, code int, reason string) {
+	for _, s := range ydb.roomSessions(name) {
+		ydb.broadcaster.Unsubscribe(name, s.sessionid)
+		s.close(code, reason)
+	}
+	ydb.dropSubdoc(name)
+	ydb.endStreams(name)
+	ydb.roomsMux.Lock()
+	delete(ydb.rooms, name)
+	ydb.roomsMux.Unlock()
+}
+
+// RoomInfo describes a room that is currently loaded by Ydb.
+type RoomInfo struct {
+	Name        YjsRoomName
+	Subscribers int
+	LastActive  time.Time
+	Offset      uint32
+}
+
+// Rooms returns the active rooms sorted by name.
+func (ydb *Ydb) Rooms() []RoomInfo {
+	ydb.roomsMux.RLock()
+	infos := make([]RoomInfo, 0, len(ydb.rooms))
+	for name, r := range ydb.rooms {
+		r.mux.Lock()
+		infos = append(infos, RoomInfo{
+			Name:        name,
+			Subscribers: int(atomic.LoadInt32(&r.subCount)),
+			LastActive:  r.lastActive,
+			Offset:      r.offset,
+		})
+		r.mux.Unlock()
+	}
+	ydb.roomsMux.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// ListRooms enumerates persisted rooms page by page. The Store must implement RoomLister.
+func (ydb *Ydb) ListRooms(prefix, cursor string, limit int) ([]RoomStat, string, error) {
+	rl, ok := ydb.store.(RoomLister)
+	if !ok {
+		return nil, "", ErrNotSupported
+	}
+	return rl.List(prefix, cursor, limit)
 }
@@ -0,0 +1,158 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidUpdate is returned for writes whose payload is not a valid Yjs update.
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// LogEntry is one framed sync message of a room's log.
+type LogEntry struct {
+	Offset  uint32 // byte offset of the frame in the log
+	Size    int    // size of the sync message, without the frame
+	Type    string // as reported by messageTypeName
+	Message []byte
+}
+
+// decodeRoomLog splits a room log into its framed sync messages.
+func decodeRoomLog(data []byte) ([]LogEntry, error) {
+	var entries []LogEntry
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		offset := uint32(len(data) - r.Len())
+		m, err := readPayload(r)
+		if err != nil {
+			return entries, fmt.Errorf("corrupt frame at offset %d: %w", offset, err)
+		}
+		entries = append(entries, LogEntry{Offset: offset, Size: len(m), Type: messageTypeName(m), Message: m})
+	}
+	return entries, nil
+}
+
+// docFromLog replays the sync step 2 and update messages of a room log into a Doc.
+func docFromLog(data []byte) (*Doc, error) {
+	entries, err := decodeRoomLog(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := NewDoc()
+	for _, e := range entries {
+		syncType, payload, err := decodeSyncMessage(e.Message)
+		if err != nil || syncType == messageYjsSyncStep1 {
+			continue
+		}
+		if err := doc.ApplyUpdate(payload); err != nil {
+			return nil, fmt.Errorf("invalid update at offset %d: %w", e.Offset, err)
+		}
+	}
+	return doc, nil
+}
+
+// mergeRoomLog returns the content of a room log as a single Yjs update.
+func mergeRoomLog(data []byte) ([]byte, error) {
+	doc, err := docFromLog(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.EncodeStateAsUpdate(nil)
+}
+
+// RoomLog returns the raw, framed log of a room as persisted by the Store.
+func (ydb *Ydb) RoomLog(name YjsRoomName) ([]byte, error) {
+	data, _, err := ydb.store.ReadFrom(name, 0)
+	return data, err
+}
+
+// RoomUpdate returns the content of a room merged into a single Yjs update.
+func (ydb *Ydb) RoomUpdate(name YjsRoomName) ([]byte, error) {
+	data, err := ydb.RoomLog(name)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRoomLog(data)
+}
+
+// RoomJSON returns the top-level shared types of a room as rendered by Doc.ToJSON.
+func (ydb *Ydb) RoomJSON(name YjsRoomName) (map[string]any, error) {
+	data, err := ydb.RoomLog(name)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := docFromLog(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.ToJSON(), nil
+}
+
+// ReplaceRoomContent replaces the log of a room with a single Yjs update.
+// Connected clients are disconnected with CloseRoomReset: they hold state that
+// is no longer part of the room and have to reload. Versions of the room are
+// deleted, their offsets don't apply to the new log, and the audit chain gets
+// a reset record.
+//
+// ReplaceRoomContent is an admin operation: the update doesn't pass the
+// interceptors, so it must not be exposed to clients that interceptors are
+// meant to restrict. MaxRoomSize still applies; a larger update fails with
+// ErrRoomTooLarge.
+func (ydb *Ydb) ReplaceRoomContent(name YjsRoomName, update []byte) error {
+	if err := NewDoc().ApplyUpdate(update); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	framed := &bytes.Buffer{}
+	writePayload(framed, encodeSyncMessage(messageYjsUpdate, update))
+	if maxRoomSize := ydb.config().MaxRoomSize; maxRoomSize > 0 && framed.Len() > int(maxRoomSize) {
+		ydb.log.Warn("room would exceed max size", "room", name, "max", maxRoomSize, "size", framed.Len())
+		return ErrRoomTooLarge
+	}
+	writeLock := ydb.writeLock(name)
+	writeLock.Lock()
+	err := ydb.store.SetInitialContent(name, framed.Bytes())
+	if err == nil {
+		err = ydb.auditReset(name, framed.Bytes())
+	}
+	writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if vs, ok := ydb.store.(VersionStore); ok {
+		if err := vs.DeleteVersions(name); err != nil {
+			return err
+		}
+	}
+	ydb.evictRoom(name, CloseRoomReset, "room reset")
+	return nil
+}
+
+// AppendUpdate appends a Yjs update to a room as if a client had sent it: it
+// passes the interceptors and is broadcast to connected clients.
+func (ydb *Ydb) AppendUpdate(name YjsRoomName, update []byte) error {
+	if err := NewDoc().ApplyUpdate(update); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	return ydb.updateRoom(name, nil, encodeSyncMessage(messageYjsUpdate, update))
+}
+
+// Edit loads the current content of a room, lets fn change it through the
+// YMap, YArray and YText handles of doc, and writes the changes like a client
+// update: they pass the interceptors, are persisted and broadcast to connected
+// clients. Every call edits with a new random client ID. Nothing is written if
+// fn returns an error or changes nothing.
+func (ydb *Ydb) Edit(name YjsRoomName, fn func(doc *Doc) error) error {
+	data, err := ydb.RoomLog(name)
+	if err != nil {
+		return err
+	}
+	doc, err := docFromLog(data)
+	if err != nil {
+		return err
+	}
+	update, err := doc.Transact(func() error { return fn(doc) })
+	if err != nil || update == nil {
+		return err
+	}
+	return ydb.updateRoom(name, nil, encodeSyncMessage(messageYjsUpdate, update))
+}
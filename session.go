@@ -77,6 +77,14 @@ type session struct {
 	sessionid          uint64
 	roomname           YjsRoomName
 	readOnly           bool
+	principal          string
+	remoteAddr         string
+	// subdocs maps the GUIDs of the subdocuments opened over the session to
+	// their rooms
+	subdocsMux    sync.Mutex
+	subdocs       map[string]YjsRoomName
+	subdocsClosed bool
+	subdocRoom    SubdocResolver
 }
 
 func newSession(sessionid uint64, roomname string) *session {
@@ -91,6 +99,20 @@ func newSessionWithAccess(sessionid uint64, roomname string, readOnly bool) *ses
 	}
 }
 
+// info describes the session for events and interceptors. A nil session stands
+// for writes made by the server itself, e.g. through the admin API.
+func (s *session) info() SessionInfo {
+	if s == nil {
+		return SessionInfo{}
+	}
+	return SessionInfo{
+		ID:         s.sessionid,
+		Principal:  s.principal,
+		RemoteAddr: s.remoteAddr,
+		ReadOnly:   s.readOnly,
+	}
+}
+
 func (s *session) sendConfirmedByHost(roomname YjsRoomName, offset uint64) {
 	s.send(createMessageConfirmedByHost(roomname, offset))
 }
@@ -110,6 +132,10 @@ func (s *session) sendUpdate(roomname YjsRoomName, data []byte, offset uint64) {
 	}
 }
 
+func (s *session) sendPermissionDenied(reason string) {
+	s.send(createMessagePermissionDenied(reason))
+}
+
 func (s *session) sendHostUnconfirmedByClient(clientConf uint64, offset uint64) {
 	s.send(createMessageHostUnconfirmedByClient(clientConf, offset))
 }
@@ -120,10 +146,21 @@ func (s *session) setConn(c conn) {
 	s.mux.Unlock()
 }
 
+func (s *session) close(code int, reason string) {
+	s.mux.Lock()
+	c := s.conn
+	s.mux.Unlock()
+	if c != nil {
+		c.Close(code, reason)
+	}
+}
+
 func (s *session) removeConn(ydb *Ydb) {
 	s.mux.Lock()
 	s.conn = nil
 	s.mux.Unlock()
 	ydb.broadcaster.Unsubscribe(s.roomname, s.sessionid)
+	s.closeSubdocs(ydb)
 	ydb.removeSession(s.sessionid)
+	ydb.emitSessionEvent(s, EventHandler.OnSessionLeft)
 }
@@ -0,0 +1,223 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultHeartbeatInterval = 15 * time.Second
+
+// errStreamReset ends a stream whose offset no longer matches the room log.
+var errStreamReset = errors.New("room log replaced")
+
+// eventStream is an SSE stream of a room, registered so that evictRoom can
+// end it.
+type eventStream struct {
+	room    YjsRoomName
+	evicted chan struct{}
+}
+
+func (ydb *Ydb) addStream(id uint64, room YjsRoomName) *eventStream {
+	stream := &eventStream{room: room, evicted: make(chan struct{})}
+	ydb.streamsMux.Lock()
+	ydb.streams[id] = stream
+	ydb.streamsMux.Unlock()
+	return stream
+}
+
+func (ydb *Ydb) removeStream(id uint64) {
+	ydb.streamsMux.Lock()
+	delete(ydb.streams, id)
+	ydb.streamsMux.Unlock()
+}
+
+// endStreams ends the streams of a room that was deleted, renamed or reset;
+// they send a reset event.
+func (ydb *Ydb) endStreams(room YjsRoomName) {
+	ydb.streamsMux.Lock()
+	defer ydb.streamsMux.Unlock()
+	for id, stream := range ydb.streams {
+		if stream.room == room {
+			close(stream.evicted)
+			delete(ydb.streams, id)
+		}
+	}
+}
+
+type sseHandler struct {
+	roomHandler
+}
+
+// NewSSEHandler streams the updates of a room as Server-Sent Events, for
+// consumers that want to tail a room without the y-protocols handshake. Rooms
+// are resolved as by NewWsHandler. The stream starts at the offset given as
+// Last-Event-ID header or, for the first connection of an EventSource, as
+// ?offset= query parameter; without either it starts at the beginning of the
+// log. It sends
+//
+//	event: update     data: the Yjs update, base64 encoded; id: the offset after it
+//	event: heartbeat  data: the current offset, every WithHeartbeatInterval
+//	event: reset      the log no longer matches the offset, the stream starts over at 0
+//
+// The id of update events is the Last-Event-ID to resume from. When the room
+// is deleted, renamed or its content replaced during a stream, a reset event
+// is sent and the stream ends.
+func NewSSEHandler(ydbInstance *Ydb, opts ...HandlerOption) http.Handler {
+	h := &sseHandler{newRoomHandler(ydbInstance, opts)}
+	if h.heartbeat <= 0 {
+		h.heartbeat = defaultHeartbeatInterval
+	}
+	return h
+}
+
+func (h *sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	room, ok := h.room(w, r)
+	if !ok {
+		return
+	}
+	offset, err := sseStartOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before reading, so that no update falls between catch-up
+	// and live data. Broadcast messages only signal that the log grew: the
+	// updates are read from the store, which knows their offsets.
+	subscriberID := h.ydb.genUint64()
+	stream := h.ydb.addStream(subscriberID, room)
+	defer h.ydb.removeStream(subscriberID)
+	broadcastCh, err := h.ydb.broadcaster.Subscribe(room, subscriberID)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	defer h.ydb.broadcaster.Unsubscribe(room, subscriberID)
+
+	data, size, err := h.ydb.store.ReadFrom(room, 0)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	reset := offset > size
+	if reset {
+		offset = 0
+	} else if _, err := logPrefix(data, offset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	// Streams outlive the write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+	if reset {
+		io.WriteString(w, "event: reset\ndata: 0\n\n")
+	}
+	offset, err = writeSSEUpdates(w, data[offset:], offset)
+	if err == nil {
+		err = rc.Flush()
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for err == nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.ydb.done:
+			return
+		case <-stream.evicted:
+			err = errStreamReset
+		case _, ok := <-broadcastCh:
+			if !ok {
+				return
+			}
+			// One read catches up with every update signalled so far
+			for len(broadcastCh) > 0 {
+				<-broadcastCh
+			}
+		case <-heartbeat.C:
+			// Also catches up when broadcast messages were dropped
+			_, err = fmt.Fprintf(w, "event: heartbeat\ndata: %d\n\n", offset)
+		}
+		if err != nil {
+			break
+		}
+		data, size, err = h.ydb.store.ReadFrom(room, offset)
+		if err != nil {
+			h.ydb.log.Error("failed to read from store", "room", room, "offset", offset, "error", err)
+			return
+		}
+		if size < offset {
+			err = errStreamReset
+			break
+		}
+		if offset, err = writeSSEUpdates(w, data, offset); err == nil {
+			err = rc.Flush()
+		}
+	}
+	if errors.Is(err, errStreamReset) {
+		io.WriteString(w, "event: reset\ndata: 0\n\n")
+		rc.Flush()
+	}
+	h.ydb.log.Debug("event stream ended", "room", room, "remote", r.RemoteAddr, "error", err)
+}
+
+// sseStartOffset returns the offset a stream starts at.
+func sseStartOffset(r *http.Request) (uint32, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("offset")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid offset")
+	}
+	return uint32(offset), nil
+}
+
+// writeSSEUpdates writes an update event for every Yjs update of data, the
+// log of a room from offset, and returns the offset after the last complete
+// message. Data that isn't a sync message means that the log was replaced
+// and offset falls inside a message; errStreamReset is returned.
+func writeSSEUpdates(w io.Writer, data []byte, offset uint32) (uint32, error) {
+	start := offset
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		m, err := readPayload(r)
+		if err != nil {
+			// Not written completely yet
+			break
+		}
+		end := start + uint32(len(data)-r.Len())
+		syncType, payload, err := decodeSyncMessage(m)
+		if err != nil {
+			return offset, errStreamReset
+		}
+		if syncType != messageYjsSyncStep1 {
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: update\ndata: %s\n\n", end, base64.StdEncoding.EncodeToString(payload)); err != nil {
+				return offset, err
+			}
+		}
+		offset = end
+	}
+	return offset, nil
+}
@@ -0,0 +1,187 @@
+package ydb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// sseStream reads the events of a Server-Sent Events response.
+type sseStream struct {
+	t      *testing.T
+	resp   *http.Response
+	events chan sseEvent
+}
+
+func openSSEStream(t *testing.T, url, lastEventID string) *sseStream {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	s := &sseStream{t: t, resp: resp, events: make(chan sseEvent, 64)}
+	go func() {
+		defer close(s.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				ev.id = value
+			case "event":
+				ev.event = value
+			case "data":
+				ev.data = value
+			case "":
+				s.events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return s
+}
+
+// next returns the next event that isn't a heartbeat, or ok false when the stream ended.
+func (s *sseStream) next() (ev sseEvent, ok bool) {
+	s.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok = <-s.events:
+			if !ok || ev.event != "heartbeat" {
+				return ev, ok
+			}
+		case <-timeout:
+			s.t.Fatal("no event received")
+		}
+	}
+}
+
+func TestSSEStream(t *testing.T) {
+	ts := newTestServer(t)
+	first := testUpdate([]testItem{{client: 1, root: "text", text: "a"}})
+	second := testUpdate([]testItem{{client: 2, root: "text", text: "b"}})
+	ts.ydb.AppendUpdate("room", first)
+	size, _ := ts.store.Size("room")
+	url := ts.httpServer.URL + "/events/room"
+
+	stream := openSSEStream(t, url, "")
+	if ct := stream.resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	ev, _ := stream.next()
+	if ev.event != "update" || ev.id != strconv.Itoa(int(size)) || ev.data != base64.StdEncoding.EncodeToString(first) {
+		t.Fatalf("unexpected catch-up event %+v", ev)
+	}
+	ts.ydb.AppendUpdate("room", second)
+	end, _ := ts.store.Size("room")
+	if ev, _ := stream.next(); ev.id != strconv.Itoa(int(end)) || ev.data != base64.StdEncoding.EncodeToString(second) {
+		t.Fatalf("unexpected live event %+v", ev)
+	}
+	heartbeat := time.After(5 * time.Second)
+	for ev := range stream.events {
+		if ev.event == "heartbeat" {
+			if ev.data != strconv.Itoa(int(end)) {
+				t.Fatalf("unexpected heartbeat %+v", ev)
+			}
+			break
+		}
+		select {
+		case <-heartbeat:
+			t.Fatal("no heartbeat received")
+		default:
+		}
+	}
+
+	resumed := openSSEStream(t, url, strconv.Itoa(int(size)))
+	if ev, _ := resumed.next(); ev.data != base64.StdEncoding.EncodeToString(second) {
+		t.Fatalf("expected to resume after the first update, got %+v", ev)
+	}
+
+	if err := ts.ydb.DeleteRoom("room"); err != nil {
+		t.Fatal(err)
+	}
+	if ev, _ := resumed.next(); ev.event != "reset" {
+		t.Fatalf("expected a reset event, got %+v", ev)
+	}
+	if _, ok := resumed.next(); ok {
+		t.Fatal("expected the stream to end")
+	}
+}
+
+func TestSSEStreamReplaced(t *testing.T) {
+	ts := newTestServer(t)
+	ts.ydb.AppendUpdate("room", testUpdate([]testItem{{client: 1, root: "text", text: "a"}}))
+	stream := openSSEStream(t, ts.httpServer.URL+"/events/room", "")
+	if ev, _ := stream.next(); ev.event != "update" {
+		t.Fatalf("unexpected catch-up event %+v", ev)
+	}
+	// The new log is longer than the offset of the stream
+	replaced := testUpdate([]testItem{{client: 2, root: "text", text: strings.Repeat("b", 100)}})
+	if err := ts.ydb.ReplaceRoomContent("room", replaced); err != nil {
+		t.Fatal(err)
+	}
+	if ev, _ := stream.next(); ev.event != "reset" {
+		t.Fatalf("expected a reset event, got %+v", ev)
+	}
+	if _, ok := stream.next(); ok {
+		t.Fatal("expected the stream to end")
+	}
+
+	// Reading from inside a message
+	framed := &bytes.Buffer{}
+	writePayload(framed, encodeSyncMessage(messageYjsUpdate, replaced))
+	if _, err := writeSSEUpdates(io.Discard, framed.Bytes()[3:], 3); err != errStreamReset {
+		t.Fatalf("expected errStreamReset, got %v", err)
+	}
+}
+
+func TestSSEStartOffsets(t *testing.T) {
+	ts := newTestServer(t)
+	update := testUpdate([]testItem{{client: 1, root: "text", text: "a"}})
+	ts.ydb.AppendUpdate("room", update)
+	size, _ := ts.store.Size("room")
+	url := ts.httpServer.URL + "/events/room"
+
+	resp, err := http.Get(url + "?offset=" + strconv.Itoa(int(size-1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an offset inside a message, got %d", resp.StatusCode)
+	}
+
+	stream := openSSEStream(t, url, strconv.Itoa(int(size+100)))
+	if ev, _ := stream.next(); ev.event != "reset" {
+		t.Fatalf("expected a reset event, got %+v", ev)
+	}
+	if ev, _ := stream.next(); ev.event != "update" || !bytes.Equal(mustBase64(t, ev.data), update) {
+		t.Fatalf("expected the stream to start over, got %+v", ev)
+	}
+}
+
+func mustBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
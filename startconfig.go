@@ -0,0 +1,526 @@
+package ydb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// startConfig is the configuration of `ydb start`: the library Config plus the
+// settings that only the standalone server needs.
+type startConfig struct {
+	Addr          string
+	PathPrefix    string
+	Dir           string
+	Tmp           bool
+	Admin         bool
+	Rest          bool
+	Events        bool
+	Metrics       bool
+	Store         string
+	Broadcaster   string
+	TLSCert       string
+	TLSKey        string
+	TLSClientCA   string
+	TLSMinVersion tlsVersion
+	LogLevel      slog.Level
+	AuditKeyFile  string
+	Config        Config
+}
+
+func defaultStartConfig() startConfig {
+	return startConfig{
+		Addr:          ":8899",
+		Store:         "disk",
+		Broadcaster:   "local",
+		TLSMinVersion: tls.VersionTLS12,
+		LogLevel:      slog.LevelWarn,
+		Config:        DefaultConfig(),
+	}
+}
+
+var startOptionUsage = map[string]string{
+	"addr":                "Address to listen on",
+	"path-prefix":         "Prefix for all HTTP paths, e.g. /ydb serves websockets on /ydb/ws",
+	"dir":                 "Directory that is used to persist data",
+	"tmp":                 "Use a temporary directory for persisting data (content is lost when server stops)",
+	"admin":               "Serve the admin API used by `ydb cli --addr` under /admin (unauthenticated)",
+	"rest":                "Serve room content over HTTP under /rooms/, with the authorization of websocket sessions",
+	"events":              "Serve the change feed of rooms as Server-Sent Events under /events/",
+	"metrics":             "Serve Prometheus metrics under /metrics and the stats of `ydb stats` under /stats (unauthenticated)",
+	"store":               "Store backend (disk)",
+	"broadcaster":         "Broadcaster backend (local)",
+	"tls-cert":            "TLS certificate file; serves HTTPS and HTTP/2 when set together with --tls-key (reloaded on SIGHUP)",
+	"tls-key":             "TLS private key file",
+	"tls-client-ca":       "CA bundle for client certificates; requires clients to present a certificate whose common name becomes the session principal",
+	"tls-min-version":     "Minimum TLS version (1.0, 1.1, 1.2, 1.3)",
+	"log-level":           "Minimum level of log records (debug, info, warn, error)",
+	"audit-key-file":      "File holding the secret that keys the audit chain; `ydb cli verify` needs the same file",
+	"send-buffer-size":    "Messages queued per connection before the sender blocks",
+	"max-message-size":    "Largest accepted websocket message in bytes (0 = unlimited)",
+	"max-room-size":       "Largest stored room in bytes (0 = unlimited)",
+	"broadcast-buffer":    "Messages buffered per broadcast subscriber",
+	"room-idle-timeout":   "Idle time after which an unused room is unloaded",
+	"room-reap-interval":  "How often idle rooms are unloaded",
+	"event-queue-size":    "Capacity of the lifecycle event queue",
+	"rate-limit-action":   "What to do with messages over a rate limit (drop, delay, disconnect)",
+	"messages-per-second": "Sustained message rate (0 = unlimited)",
+	"bytes-per-second":    "Sustained byte rate (0 = unlimited)",
+	"message-burst":       "Message bucket size (0 = one second worth)",
+	"byte-burst":          "Byte bucket size (0 = one second worth)",
+	"journal":             "Record the session, principal, address and time of every update",
+	"audit":               "Keep a hash chained audit log of every update, checked by `ydb cli verify`",
+	"max-subdocs":         "Subdocuments a websocket session can have open at once (0 = unlimited)",
+}
+
+// startOption is a setting of startConfig. Every option can be given as a
+// flag (--max-room-size), an environment variable (YDB_MAX_ROOM_SIZE) or a
+// config file key (max_room_size). Fields of nested structs are separated by
+// a dot: --session-rate-limit.messages-per-second.
+type startOption struct {
+	name  string
+	usage string
+	value optionValue
+}
+
+func (o startOption) envName() string {
+	return "YDB_" + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(o.name))
+}
+
+func (o startOption) fileKey() string {
+	return strings.ReplaceAll(o.name, "-", "_")
+}
+
+// startOptions lists the options of sc in declaration order. Config fields
+// that can't be expressed as text (Logger, EventHandler, Interceptors, Webhooks) are
+// only available to library users.
+func startOptions(sc *startConfig) []startOption {
+	var options []startOption
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field, fv := v.Type().Field(i), v.Field(i)
+			name := prefix + kebabCase(field.Name)
+			if field.Type == reflect.TypeOf(Config{}) {
+				walk(fv, prefix)
+				continue
+			}
+			if !isOptionType(field.Type) {
+				if field.Type.Kind() == reflect.Struct {
+					walk(fv, name+".")
+				}
+				continue
+			}
+			usage := startOptionUsage[name]
+			if usage == "" {
+				usage = startOptionUsage[kebabCase(field.Name)]
+			}
+			options = append(options, startOption{name: name, usage: usage, value: optionValue{fv}})
+		}
+	}
+	walk(reflect.ValueOf(sc).Elem(), "")
+	return options
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func isOptionType(t reflect.Type) bool {
+	if t == durationType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// kebabCase turns a Go field name into a flag name: TLSCert -> tls-cert.
+func kebabCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte('-')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// optionValue is a flag.Value backed by a struct field.
+type optionValue struct {
+	v reflect.Value
+}
+
+func (o optionValue) String() string {
+	if !o.v.IsValid() {
+		return ""
+	}
+	if o.v.Type() == durationType {
+		return time.Duration(o.v.Int()).String()
+	}
+	if m, ok := o.v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return strings.ToLower(string(text))
+	}
+	return fmt.Sprint(o.v.Interface())
+}
+
+func (o optionValue) Set(s string) error {
+	if o.v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		o.v.SetInt(int64(d))
+		return nil
+	}
+	if u, ok := o.v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch o.v.Kind() {
+	case reflect.String:
+		o.v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		o.v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, o.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		o.v.SetInt(n)
+	case reflect.Uint32:
+		n, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return err
+		}
+		o.v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		o.v.SetFloat(f)
+	}
+	return nil
+}
+
+func (o optionValue) IsBoolFlag() bool {
+	return o.v.IsValid() && o.v.Kind() == reflect.Bool
+}
+
+// Sources of an effective setting, from lowest to highest precedence.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// startSettings is the result of parseStartConfig.
+type startSettings struct {
+	startConfig
+	options []startOption
+	sources map[string]string // option name -> source
+}
+
+// newStartFlagSet registers a flag for every option of the returned settings.
+// The config file is given with --config or YDB_CONFIG.
+func newStartFlagSet(name string, errorHandling flag.ErrorHandling) (*flag.FlagSet, *startSettings, *string) {
+	s := &startSettings{startConfig: defaultStartConfig(), sources: make(map[string]string)}
+	s.options = startOptions(&s.startConfig)
+	fs := flag.NewFlagSet(name, errorHandling)
+	configFile := fs.String("config", "", "Config file (.json, .yaml, .yml or .toml); also YDB_CONFIG")
+	for _, o := range s.options {
+		fs.Var(o.value, o.name, o.usage)
+		s.sources[o.name] = sourceDefault
+	}
+	return fs, s, configFile
+}
+
+// parseStartConfig applies args, environment variables and the config file
+// to s. Flags take precedence over environment variables, which take
+// precedence over the config file.
+func parseStartConfig(fs *flag.FlagSet, s *startSettings, configFile *string, args []string, lookupEnv func(string) (string, bool)) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := s.sources[f.Name]; ok {
+			s.sources[f.Name] = sourceFlag
+		}
+	})
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("YDB_CONFIG")
+	}
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		byKey := make(map[string]startOption, len(s.options))
+		for _, o := range s.options {
+			byKey[o.fileKey()] = o
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o, ok := byKey[strings.ReplaceAll(strings.ToLower(key), "-", "_")]
+			if !ok {
+				return fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			if s.sources[o.name] == sourceFlag {
+				continue
+			}
+			if err := o.value.Set(values[key]); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %v", path, values[key], key, err)
+			}
+			s.sources[o.name] = sourceFile
+		}
+	}
+
+	for _, o := range s.options {
+		value, ok := lookupEnv(o.envName())
+		if !ok || s.sources[o.name] == sourceFlag {
+			continue
+		}
+		if err := o.value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, o.envName(), err)
+		}
+		s.sources[o.name] = sourceEnv
+	}
+	if s.AuditKeyFile != "" {
+		key, err := readAuditKey(s.AuditKeyFile)
+		if err != nil {
+			return err
+		}
+		s.Config.AuditKey = key
+	}
+	return nil
+}
+
+// readAuditKey returns the secret stored in path, without surrounding white
+// space.
+func readAuditKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// readConfigFile returns the settings of a config file as flat key/value
+// pairs; nested tables are flattened with a dot.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		values, err = parseJSONConfig(data)
+	case ".yaml", ".yml":
+		values, err = parseYAMLConfig(data)
+	case ".toml":
+		values, err = parseTOMLConfig(data)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file format %q (want .json, .yaml, .yml or .toml)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	var flatten func(m map[string]any, prefix string) error
+	flatten = func(m map[string]any, prefix string) error {
+		for k, v := range m {
+			switch v := v.(type) {
+			case map[string]any:
+				if err := flatten(v, prefix+k+"."); err != nil {
+					return err
+				}
+			case []any, nil:
+				return fmt.Errorf("unsupported value for %s", prefix+k)
+			default:
+				values[prefix+k] = fmt.Sprint(v)
+			}
+		}
+		return nil
+	}
+	return values, flatten(doc, "")
+}
+
+// parseYAMLConfig reads the subset of YAML needed for flat settings:
+// `key: value` lines, optionally grouped under one level of `section:`.
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	err := scanConfigLines(data, func(n int, line string) error {
+		indented := line[0] == ' ' || line[0] == '\t'
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			return fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case !indented && value == "":
+			section = key + "."
+		case !indented:
+			section = ""
+			values[key] = unquoteConfigValue(value)
+		case section == "":
+			return fmt.Errorf("line %d: unexpected indentation", n)
+		default:
+			values[section+key] = unquoteConfigValue(value)
+		}
+		return nil
+	})
+	return values, err
+}
+
+// parseTOMLConfig reads the subset of TOML needed for flat settings:
+// `key = value` lines and `[section]` tables.
+func parseTOMLConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	err := scanConfigLines(data, func(n int, line string) error {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: malformed table header", n)
+			}
+			section = strings.TrimSpace(line[1:len(line)-1]) + "."
+			return nil
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", n)
+		}
+		values[section+strings.TrimSpace(key)] = unquoteConfigValue(strings.TrimSpace(value))
+		return nil
+	})
+	return values, err
+}
+
+// scanConfigLines calls fn for each line that isn't blank or a comment, with
+// trailing comments removed.
+func scanConfigLines(data []byte, fn func(n int, line string) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := stripConfigComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func stripConfigComment(line string) string {
+	quote := rune(0)
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+func unquoteConfigValue(value string) string {
+	if len(value) >= 2 {
+		switch value[0] {
+		case '"':
+			if s, err := strconv.Unquote(value); err == nil {
+				return s
+			}
+		case '\'':
+			if value[len(value)-1] == '\'' {
+				return value[1 : len(value)-1]
+			}
+		}
+	}
+	return value
+}
+
+// printStartConfig writes the effective settings as a YAML config file,
+// annotated with where each value came from.
+func printStartConfig(w io.Writer, s *startSettings) {
+	for _, o := range s.options {
+		value := o.value.String()
+		if o.value.v.Kind() == reflect.String {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s: %s  # %s\n", o.fileKey(), value, s.sources[o.name])
+	}
+}
+
+// newStartBackends creates the Store and Broadcaster selected by sc.
+func newStartBackends(sc *startConfig) (Store, Broadcaster, error) {
+	var store Store
+	switch sc.Store {
+	case "disk":
+		// MaxRoomSize is enforced by Ydb, where UpdateConfig can change it
+		store = NewDiskStore(sc.Dir)
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q (available: disk)", sc.Store)
+	}
+	var broadcaster Broadcaster
+	switch sc.Broadcaster {
+	case "local":
+		broadcaster = NewLocalBroadcaster(sc.Config.BroadcastBuffer)
+	default:
+		return nil, nil, fmt.Errorf("unknown broadcaster %q (available: local)", sc.Broadcaster)
+	}
+	return store, broadcaster, nil
+}
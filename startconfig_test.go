@@ -0,0 +1,222 @@
+package ydb
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestStartConfig(t *testing.T, args []string, env map[string]string) (*startSettings, error) {
+	t.Helper()
+	fs, s, configFile := newStartFlagSet("start", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	lookupEnv := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	return s, parseStartConfig(fs, s, configFile, args, lookupEnv)
+}
+
+func writeTestConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStartOptionNames(t *testing.T) {
+	s, err := parseTestStartConfig(t, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]startOption)
+	for _, o := range s.options {
+		names[o.name] = o
+	}
+	for _, name := range []string{"addr", "path-prefix", "tls-cert", "log-level", "send-buffer-size",
+		"max-room-size", "room-idle-timeout", "rate-limit-action", "ip-rate-limit.messages-per-second"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("missing option %s", name)
+		}
+	}
+	for _, name := range []string{"logger", "event-handler", "interceptors", "webhooks"} {
+		if _, ok := names[name]; ok {
+			t.Errorf("unexpected option %s", name)
+		}
+	}
+	o := names["session-rate-limit.bytes-per-second"]
+	if o.envName() != "YDB_SESSION_RATE_LIMIT_BYTES_PER_SECOND" || o.fileKey() != "session_rate_limit.bytes_per_second" {
+		t.Errorf("unexpected names %s, %s", o.envName(), o.fileKey())
+	}
+}
+
+func TestStartConfigPrecedence(t *testing.T) {
+	path := writeTestConfigFile(t, "ydb.yaml", `
+# file sets everything, env and flags override parts of it
+addr: ":9000"
+max_room_size: 1000
+send_buffer_size: 8
+room_idle_timeout: 30s
+`)
+	env := map[string]string{
+		"YDB_CONFIG":           path,
+		"YDB_MAX_ROOM_SIZE":    "2000",
+		"YDB_SEND_BUFFER_SIZE": "16",
+	}
+	s, err := parseTestStartConfig(t, []string{"--send-buffer-size", "32"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Addr != ":9000" || s.Config.RoomIdleTimeout != 30*time.Second {
+		t.Errorf("file values not applied: %+v", s.startConfig)
+	}
+	if s.Config.MaxRoomSize != 2000 {
+		t.Errorf("env should override file, got MaxRoomSize %d", s.Config.MaxRoomSize)
+	}
+	if s.Config.SendBufferSize != 32 {
+		t.Errorf("flag should override env, got SendBufferSize %d", s.Config.SendBufferSize)
+	}
+	if s.Config.BroadcastBuffer != DefaultConfig().BroadcastBuffer {
+		t.Errorf("default lost: %d", s.Config.BroadcastBuffer)
+	}
+	want := map[string]string{"addr": sourceFile, "max-room-size": sourceEnv, "send-buffer-size": sourceFlag, "broadcast-buffer": sourceDefault}
+	for name, source := range want {
+		if s.sources[name] != source {
+			t.Errorf("source of %s = %s, want %s", name, s.sources[name], source)
+		}
+	}
+}
+
+func TestStartConfigFileFormats(t *testing.T) {
+	files := map[string]string{
+		"ydb.json": `{"max_message_size": 4096, "rate_limit_action": "delay", "log_level": "debug",
+			"room_rate_limit": {"messages_per_second": 12.5}}`,
+		"ydb.yaml": `
+max_message_size: 4096
+rate_limit_action: 'delay'   # quoted
+log_level: debug
+room_rate_limit:
+  messages_per_second: 12.5
+`,
+		"ydb.toml": `
+max_message_size = 4096
+rate_limit_action = "delay"
+log_level = "debug"
+
+[room_rate_limit]
+messages_per_second = 12.5
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeTestConfigFile(t, name, content)
+			s, err := parseTestStartConfig(t, []string{"--config", path}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := s.Config
+			if cfg.MaxMessageSize != 4096 || cfg.RateLimitAction != RateLimitDelay ||
+				cfg.RoomRateLimit.MessagesPerSecond != 12.5 || s.LogLevel != slog.LevelDebug {
+				t.Fatalf("unexpected config: %+v", s.startConfig)
+			}
+		})
+	}
+}
+
+func TestStartConfigErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		args []string
+		env  map[string]string
+	}{
+		{name: "unknown file key", file: "ydb.yaml", args: nil, env: nil},
+		{name: "bad env value", env: map[string]string{"YDB_ROOM_IDLE_TIMEOUT": "soon"}},
+		{name: "bad flag value", args: []string{"--rate-limit-action", "explode"}},
+		{name: "unsupported format", file: "ydb.ini"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := c.args
+			if c.file != "" {
+				args = append(args, "--config", writeTestConfigFile(t, c.file, "no_such_setting: 1\n"))
+			}
+			if _, err := parseTestStartConfig(t, args, c.env); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestStartConfigAuditKey(t *testing.T) {
+	path := writeTestConfigFile(t, "audit.key", "secret\n")
+	s, err := parseTestStartConfig(t, nil, map[string]string{"YDB_AUDIT_KEY_FILE": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Config.AuditKey) != "secret" {
+		t.Fatalf("unexpected audit key %q", s.Config.AuditKey)
+	}
+	for _, o := range s.options {
+		if o.name == "audit-key" {
+			t.Fatal("the audit key must not be an option")
+		}
+	}
+	empty := writeTestConfigFile(t, "empty.key", "\n")
+	if _, err := parseTestStartConfig(t, []string{"--audit-key-file", empty}, nil); err == nil {
+		t.Fatal("expected an error for an empty key file")
+	}
+}
+
+func TestPrintStartConfigRoundTrip(t *testing.T) {
+	s, err := parseTestStartConfig(t, []string{"--addr", "localhost:1234", "--room-reap-interval", "10s", "--path-prefix", "/ydb"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	printStartConfig(out, s)
+	if !strings.Contains(out.String(), `addr: "localhost:1234"  # flag`) {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	// The printed configuration is a valid config file for the same settings
+	path := writeTestConfigFile(t, "printed.yaml", out.String())
+	reloaded, err := parseTestStartConfig(t, []string{"--config", path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Addr != s.Addr || reloaded.PathPrefix != "/ydb" || reloaded.Config.RoomReapInterval != 10*time.Second {
+		t.Fatalf("round trip changed the config: %+v", reloaded.startConfig)
+	}
+}
+
+func TestNewServeMuxPathPrefix(t *testing.T) {
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	sc := &startConfig{PathPrefix: "/ydb/"}
+	mux := newServeMux(sc, ydbInstance)
+	for path, registered := range map[string]bool{"/ydb/ws/room": true, "/ws/room": false, "/ydb/admin/rooms": false,
+		"/ydb/rooms/room": false, "/ydb/events/room": false, "/ydb/metrics": false, "/ydb/stats": false} {
+		_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, path, nil))
+		if (pattern != "") != registered {
+			t.Errorf("%s: pattern %q", path, pattern)
+		}
+	}
+	sc.Rest, sc.Events, sc.Metrics = true, true, true
+	mux = newServeMux(sc, ydbInstance)
+	for _, path := range []string{"/ydb/rooms/room", "/ydb/events/room", "/ydb/metrics", "/ydb/stats"} {
+		if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, path, nil)); pattern == "" {
+			t.Errorf("%s is not served with --rest, --events and --metrics", path)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package ydb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats is a point-in-time summary of a Ydb instance, served as JSON by StatsHandler.
+type Stats struct {
+	Time        time.Time   `json:"time"`
+	Uptime      float64     `json:"uptime_seconds"`
+	Sessions    int         `json:"sessions"`
+	MessagesIn  uint64      `json:"messages_in"`
+	BytesIn     uint64      `json:"bytes_in"`
+	MessagesOut uint64      `json:"messages_out"`
+	BytesOut    uint64      `json:"bytes_out"`
+	Updates     uint64      `json:"updates"`
+	StoreBytes  uint64      `json:"store_bytes"`
+	Rooms       []RoomStats `json:"rooms"`
+}
+
+// RoomStats describes an active room. Updates and Bytes count the updates
+// persisted since the room was loaded.
+type RoomStats struct {
+	Name        YjsRoomName `json:"name"`
+	Subscribers int         `json:"subscribers"`
+	Size        uint32      `json:"size"`
+	Updates     uint64      `json:"updates"`
+	Bytes       uint64      `json:"bytes"`
+	LastActive  time.Time   `json:"last_active"`
+}
+
+// Stats collects the current statistics of the instance.
+func (ydb *Ydb) Stats() Stats {
+	now := time.Now()
+	m := ydb.metrics
+	st := Stats{
+		Time:    now,
+		Uptime:  now.Sub(ydb.started).Seconds(),
+		Updates: atomic.LoadUint64(&m.updates),
+		Rooms:   []RoomStats{},
+	}
+	st.Sessions, _, _ = ydb.sessionStats()
+	for _, v := range m.messagesIn.snapshot() {
+		st.MessagesIn += v
+	}
+	for _, v := range m.bytesIn.snapshot() {
+		st.BytesIn += v
+	}
+	for _, v := range m.messagesOut.snapshot() {
+		st.MessagesOut += v
+	}
+	for _, v := range m.bytesOut.snapshot() {
+		st.BytesOut += v
+	}
+
+	ydb.roomsMux.RLock()
+	for name, r := range ydb.rooms {
+		r.mux.Lock()
+		rs := RoomStats{
+			Name:        name,
+			Subscribers: int(atomic.LoadInt32(&r.subCount)),
+			Size:        r.offset,
+			Updates:     atomic.LoadUint64(&r.updates),
+			Bytes:       atomic.LoadUint64(&r.bytes),
+			LastActive:  r.lastActive,
+		}
+		r.mux.Unlock()
+		st.StoreBytes += uint64(rs.Size)
+		st.Rooms = append(st.Rooms, rs)
+	}
+	ydb.roomsMux.RUnlock()
+	sort.Slice(st.Rooms, func(i, j int) bool { return st.Rooms[i].Name < st.Rooms[j].Name })
+	return st
+}
+
+// StatsHandler serves Stats as JSON for `ydb stats`.
+func (ydb *Ydb) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ydb.Stats())
+	})
+}
+
+func fetchStats(client *http.Client, url string) (*Stats, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	st := &Stats{}
+	if err := json.NewDecoder(resp.Body).Decode(st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// statsURL turns the --addr operand into the URL of the stats endpoint.
+func statsURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if strings.HasSuffix(addr, "/stats") {
+		return addr
+	}
+	return strings.TrimSuffix(addr, "/") + "/stats"
+}
+
+type roomActivity struct {
+	RoomStats
+	updateRate float64
+	byteRate   float64
+}
+
+// renderStats prints a summary of cur. If prev is set, throughput is computed
+// from the difference between both samples and rooms are ranked by update
+// rate, otherwise by total updates.
+func renderStats(w io.Writer, prev, cur *Stats, top int) {
+	elapsed := 0.0
+	if prev != nil {
+		elapsed = cur.Time.Sub(prev.Time).Seconds()
+	}
+	rate := func(now, before uint64) float64 {
+		if elapsed <= 0 || now < before {
+			return 0
+		}
+		return float64(now-before) / elapsed
+	}
+
+	fmt.Fprintf(w, "ydb stats — %s (up %s)\n\n", cur.Time.Format(time.RFC3339), time.Duration(cur.Uptime*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(w, "rooms %d   sessions %d   stored %s\n", len(cur.Rooms), cur.Sessions, formatBytes(cur.StoreBytes))
+	if prev != nil {
+		fmt.Fprintf(w, "in  %.1f msg/s %s/s   out %.1f msg/s %s/s   updates %.1f/s\n\n",
+			rate(cur.MessagesIn, prev.MessagesIn), formatBytes(uint64(rate(cur.BytesIn, prev.BytesIn))),
+			rate(cur.MessagesOut, prev.MessagesOut), formatBytes(uint64(rate(cur.BytesOut, prev.BytesOut))),
+			rate(cur.Updates, prev.Updates))
+	} else {
+		fmt.Fprintf(w, "in  %d msgs %s   out %d msgs %s   updates %d\n\n",
+			cur.MessagesIn, formatBytes(cur.BytesIn), cur.MessagesOut, formatBytes(cur.BytesOut), cur.Updates)
+	}
+
+	previous := make(map[YjsRoomName]RoomStats)
+	if prev != nil {
+		for _, r := range prev.Rooms {
+			previous[r.Name] = r
+		}
+	}
+	rooms := make([]roomActivity, 0, len(cur.Rooms))
+	for _, r := range cur.Rooms {
+		a := roomActivity{RoomStats: r}
+		if p, ok := previous[r.Name]; ok {
+			a.updateRate = rate(r.Updates, p.Updates)
+			a.byteRate = rate(r.Bytes, p.Bytes)
+		}
+		rooms = append(rooms, a)
+	}
+	sort.SliceStable(rooms, func(i, j int) bool {
+		if rooms[i].updateRate != rooms[j].updateRate {
+			return rooms[i].updateRate > rooms[j].updateRate
+		}
+		if rooms[i].Updates != rooms[j].Updates {
+			return rooms[i].Updates > rooms[j].Updates
+		}
+		return rooms[i].Name < rooms[j].Name
+	})
+	if top > 0 && len(rooms) > top {
+		rooms = rooms[:top]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOM\tSESSIONS\tSIZE\tUPDATES\tUPDATES/S\tBYTES/S\tLAST ACTIVE")
+	for _, r := range rooms {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%.1f\t%s\t%s\n",
+			r.Name, r.Subscribers, formatBytes(uint64(r.Size)), r.Updates,
+			r.updateRate, formatBytes(uint64(r.byteRate)), r.LastActive.Format(time.TimeOnly))
+	}
+	tw.Flush()
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
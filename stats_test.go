@@ -0,0 +1,97 @@
+package ydb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsHandler(t *testing.T) {
+	ydbInstance := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("stats-room")
+	s.setConn(&mockConn{})
+	ydbInstance.subscribeRoom(s, 0)
+	update := makeYjsSyncUpdate([]byte("data"))
+	ydbInstance.updateRoom("stats-room", s, update)
+	ydbInstance.updateRoom("stats-room", s, update)
+
+	server := httptest.NewServer(ydbInstance.StatsHandler())
+	defer server.Close()
+
+	st, err := fetchStats(http.DefaultClient, server.URL)
+	if err != nil {
+		t.Fatalf("fetchStats failed: %v", err)
+	}
+	if st.Sessions != 1 || st.Updates != 2 || len(st.Rooms) != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	room := st.Rooms[0]
+	if room.Name != "stats-room" || room.Subscribers != 1 || room.Updates != 2 || room.Bytes != uint64(2*len(update)) {
+		t.Fatalf("unexpected room stats: %+v", room)
+	}
+	if st.StoreBytes != uint64(room.Size) || room.Size == 0 {
+		t.Fatalf("expected store bytes to match room size: %+v", st)
+	}
+}
+
+func TestStatsURL(t *testing.T) {
+	cases := map[string]string{
+		"localhost:8899":               "http://localhost:8899/stats",
+		"https://ydb.example.com/":     "https://ydb.example.com/stats",
+		"http://127.0.0.1:8899/stats":  "http://127.0.0.1:8899/stats",
+		"http://127.0.0.1:8899/admin/": "http://127.0.0.1:8899/admin/stats",
+	}
+	for addr, want := range cases {
+		if got := statsURL(addr); got != want {
+			t.Errorf("statsURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestRenderStatsRanksBusiestRooms(t *testing.T) {
+	now := time.Now()
+	prev := &Stats{
+		Time:    now.Add(-2 * time.Second),
+		Updates: 10,
+		Rooms: []RoomStats{
+			{Name: "quiet", Updates: 100},
+			{Name: "busy", Updates: 5},
+			{Name: "medium", Updates: 5},
+		},
+	}
+	cur := &Stats{
+		Time:    now,
+		Updates: 30,
+		Rooms: []RoomStats{
+			{Name: "quiet", Updates: 100},
+			{Name: "busy", Updates: 25, Bytes: 2048},
+			{Name: "medium", Updates: 9},
+		},
+	}
+
+	var buf bytes.Buffer
+	renderStats(&buf, prev, cur, 2)
+	out := buf.String()
+	if !strings.Contains(out, "updates 10.0/s") {
+		t.Fatalf("expected overall update rate, got:\n%s", out)
+	}
+	lines := strings.Split(out, "\n")
+	var table []string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "ROOM") {
+			table = lines[i+1:]
+			break
+		}
+	}
+	if len(table) < 2 || !strings.HasPrefix(table[0], "busy") || !strings.HasPrefix(table[1], "medium") {
+		t.Fatalf("expected busy and medium as top rooms, got:\n%s", out)
+	}
+	if strings.Contains(out, "quiet") {
+		t.Fatalf("expected top-N to cut off the idle room, got:\n%s", out)
+	}
+}
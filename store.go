@@ -1,8 +1,132 @@
 package ydb
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRoomNotFound  = errors.New("room not found")
+	ErrRoomExists    = errors.New("room already exists")
+	ErrNotSupported  = errors.New("operation not supported by store")
+	ErrRoomTooLarge  = errors.New("room would exceed max size")
+	ErrVersionExists = errors.New("version already exists")
+)
+
 type Store interface {
 	Append(room YjsRoomName, data []byte) (newOffset uint32, err error)
 	ReadFrom(room YjsRoomName, offset uint32) ([]byte, uint32, error)
 	Size(room YjsRoomName) (uint32, error)
 	SetInitialContent(room YjsRoomName, data []byte) error
 }
+
+// RoomManager is an optional Store extension used by Ydb.DeleteRoom and
+// Ydb.RenameRoom. Rename must move the data atomically and fail with
+// ErrRoomExists if the target room already has data.
+type RoomManager interface {
+	Delete(room YjsRoomName) error
+	Rename(from, to YjsRoomName) error
+}
+
+// RoomStat describes a persisted room.
+type RoomStat struct {
+	Name    YjsRoomName
+	Size    uint32
+	ModTime time.Time
+}
+
+// RoomLister is an optional Store extension for enumerating persisted rooms.
+// Rooms whose name starts with prefix are returned in lexical order, beginning
+// after cursor. At most limit rooms are returned (all if limit <= 0); nextCursor
+// is empty once the listing is exhausted.
+type RoomLister interface {
+	List(prefix, cursor string, limit int) (rooms []RoomStat, nextCursor string, err error)
+}
+
+// Version is a named point in the history of a room: the room content is the
+// log up to Offset.
+type Version struct {
+	Name   string    `json:"name"`
+	Offset uint32    `json:"offset"`
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+}
+
+// VersionStore is an optional Store extension that keeps the versions of a
+// room alongside its log. AddVersion fails with ErrVersionExists if the room
+// already has a version of that name. Versions are returned in the order they
+// were added. Delete and Rename of a RoomManager apply to the versions too.
+type VersionStore interface {
+	AddVersion(room YjsRoomName, v Version) error
+	Versions(room YjsRoomName) ([]Version, error)
+	DeleteVersions(room YjsRoomName) error
+}
+
+// JournalEntry describes one Append to a room log: the bytes from Offset to
+// EndOffset and who wrote them. Session and Principal are empty for writes
+// made by the server itself.
+type JournalEntry struct {
+	Offset     uint32    `json:"offset"`
+	EndOffset  uint32    `json:"end_offset"`
+	Size       int       `json:"size"`
+	Time       time.Time `json:"time"`
+	Session    uint64    `json:"session,omitempty"`
+	Principal  string    `json:"principal,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+}
+
+// JournalStore is an optional Store extension that records a JournalEntry per
+// update when Config.Journal is set. Journal returns the entries of a room
+// written in [since, until) in the order they were recorded; zero times leave
+// that end open. Delete and Rename of a RoomManager apply to the journal too.
+// The journal survives SetInitialContent, so offsets of older entries refer to
+// the log before it was replaced.
+type JournalStore interface {
+	AppendJournal(room YjsRoomName, entry JournalEntry) error
+	Journal(room YjsRoomName, since, until time.Time) ([]JournalEntry, error)
+}
+
+// AuditRecord is a link of the audit chain of a room. It attests that the
+// room log held the bytes with SHA-256 Digest from Offset to EndOffset, and
+// Hash covers the record including the Hash of the previous record, Prev.
+// Reset records start over at offset 0: the log was replaced, or was written
+// before auditing started, and is taken as is up to EndOffset.
+type AuditRecord struct {
+	Offset    uint32    `json:"offset"`
+	EndOffset uint32    `json:"end_offset"`
+	Time      time.Time `json:"time"`
+	Reset     bool      `json:"reset,omitempty"`
+	Digest    string    `json:"digest"`
+	Prev      string    `json:"prev"`
+	Hash      string    `json:"hash"`
+}
+
+// AuditStore is an optional Store extension that keeps the audit chain of a
+// room when Config.Audit is set. LastAudit returns the most recent record, ok
+// is false for rooms without records. Records are returned in the order they
+// were appended. Delete and Rename of a RoomManager apply to the chain too.
+type AuditStore interface {
+	AppendAudit(room YjsRoomName, rec AuditRecord) error
+	LastAudit(room YjsRoomName) (rec AuditRecord, ok bool, err error)
+	AuditRecords(room YjsRoomName) ([]AuditRecord, error)
+}
+
+// ForkInfo links a room created by Ydb.Fork to the room it was forked from.
+type ForkInfo struct {
+	Parent YjsRoomName `json:"parent"`
+	// Offset is the end of the parent's log when the fork was created
+	Offset uint32 `json:"offset"`
+	// StateVector is the encoded Yjs state vector of the fork when it was
+	// created or last merged; MergeFork sends the parent what came after.
+	StateVector []byte    `json:"state_vector"`
+	Time        time.Time `json:"time"`
+	Merges      int       `json:"merges"`
+}
+
+// ForkStore is an optional Store extension that keeps the parent link of
+// forked rooms. Delete and Rename of a RoomManager apply to the link of the
+// fork; links pointing at a renamed or deleted parent are left alone.
+type ForkStore interface {
+	SetForkInfo(room YjsRoomName, info ForkInfo) error
+	ForkInfo(room YjsRoomName) (info ForkInfo, ok bool, err error)
+}
@@ -0,0 +1,218 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Yjs subdocuments are documents referenced by GUID from another document. A
+// websocket session carries the subdocuments of its room next to the room
+// itself, each stored in a room of its own:
+//
+//	[messageSubdoc][guid][message]   a message of the subdocument guid
+//	[messageSubdocClose][guid]       the subdocument guid is closed
+//
+// guid and message are length prefixed. The first message for a GUID opens the
+// subdocument: the session receives its log and then its live updates, each
+// wrapped in a messageSubdoc. An empty message only opens it. Only sync
+// messages are read from clients, other messages are ignored.
+//
+// Clients close subdocuments they unload. The server closes a subdocument
+// that can't be opened, and one whose room is deleted, renamed or reset; the
+// client has to reload it, as for the close codes of a room.
+
+// SubdocResolver returns the room that stores the subdocument guid opened by a
+// session of the room root. Returning an error refuses the subdocument.
+type SubdocResolver func(root YjsRoomName, guid string) (YjsRoomName, error)
+
+var (
+	errTooManySubdocs = errors.New("too many subdocuments")
+	errSessionClosed  = errors.New("session closed")
+)
+
+// defaultSubdocRoom stores a subdocument next to its root room, as
+// "<room>~<guid>" with the GUID path escaped. A room below the root, such as
+// "<room>/<guid>", would need the root to be a directory on a DiskStore.
+func defaultSubdocRoom(root YjsRoomName, guid string) (YjsRoomName, error) {
+	return root + "~" + YjsRoomName(url.PathEscape(guid)), nil
+}
+
+func createMessageSubdoc(guid string, m []byte) []byte {
+	buf := &bytes.Buffer{}
+	writeUvarint(buf, messageSubdoc)
+	writeString(buf, guid)
+	writePayload(buf, m)
+	return buf.Bytes()
+}
+
+func createMessageSubdocClose(guid string) []byte {
+	buf := &bytes.Buffer{}
+	writeUvarint(buf, messageSubdocClose)
+	writeString(buf, guid)
+	return buf.Bytes()
+}
+
+func (ydb *Ydb) readSubdocMessage(m message, session *session) error {
+	guid, err := readString(m)
+	if err != nil {
+		return err
+	}
+	payload, err := readPayload(m)
+	if err != nil {
+		return err
+	}
+	roomname, err := ydb.openSubdoc(session, guid)
+	if err != nil {
+		ydb.log.Info("subdocument refused", "room", session.roomname, "session", session.sessionid, "guid", guid, "error", err)
+		session.send(createMessageSubdocClose(guid))
+		return nil
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	inner := bytes.NewBuffer(payload)
+	messageType, err := binary.ReadUvarint(inner)
+	if err != nil {
+		return err
+	}
+	if messageType != messageSync {
+		ydb.log.Debug("received unknown subdocument message type", "room", roomname, "session", session.sessionid, "type", messageType)
+		return nil
+	}
+	ydb.log.Debug("reading subdocument sync message", "room", roomname, "session", session.sessionid)
+	return ydb.readUpdateMessage(inner, session, roomname)
+}
+
+func (ydb *Ydb) readSubdocClose(m message, session *session) error {
+	guid, err := readString(m)
+	if err != nil {
+		return err
+	}
+	session.subdocsMux.Lock()
+	roomname, ok := session.subdocs[guid]
+	delete(session.subdocs, guid)
+	session.subdocsMux.Unlock()
+	if ok {
+		ydb.broadcaster.Unsubscribe(roomname, session.sessionid)
+		ydb.log.Debug("subdocument closed", "room", roomname, "session", session.sessionid, "guid", guid)
+	}
+	return nil
+}
+
+// openSubdoc returns the room of the subdocument guid, subscribing the
+// session to it if it isn't open yet.
+func (ydb *Ydb) openSubdoc(session *session, guid string) (YjsRoomName, error) {
+	session.subdocsMux.Lock()
+	if roomname, ok := session.subdocs[guid]; ok {
+		session.subdocsMux.Unlock()
+		return roomname, nil
+	}
+	roomname, err := ydb.resolveSubdoc(session, guid)
+	if err != nil {
+		session.subdocsMux.Unlock()
+		return "", err
+	}
+	if session.subdocs == nil {
+		session.subdocs = make(map[string]YjsRoomName)
+	}
+	session.subdocs[guid] = roomname
+	session.subdocsMux.Unlock()
+
+	// Catching up can block on a full send queue, so it happens outside the
+	// lock that closing the session needs
+	err = ydb.subscribe(session, roomname, 0, func(data []byte) {
+		session.send(createMessageSubdoc(guid, data))
+	})
+	session.subdocsMux.Lock()
+	defer session.subdocsMux.Unlock()
+	if session.subdocs[guid] != roomname {
+		// Closed meanwhile, with the session or by evictRoom
+		ydb.broadcaster.Unsubscribe(roomname, session.sessionid)
+		return "", errSessionClosed
+	}
+	if err != nil {
+		delete(session.subdocs, guid)
+		return "", err
+	}
+	ydb.log.Debug("subdocument opened", "room", roomname, "session", session.sessionid, "guid", guid)
+	return roomname, nil
+}
+
+// resolveSubdoc returns the room for a new subdocument of session. The caller
+// holds session.subdocsMux.
+func (ydb *Ydb) resolveSubdoc(session *session, guid string) (YjsRoomName, error) {
+	if session.subdocsClosed {
+		return "", errSessionClosed
+	}
+	if guid == "" {
+		return "", errors.New("missing subdocument guid")
+	}
+	if max := ydb.config().MaxSubdocs; max > 0 && len(session.subdocs) >= max {
+		return "", errTooManySubdocs
+	}
+	resolve := session.subdocRoom
+	if resolve == nil {
+		resolve = defaultSubdocRoom
+	}
+	roomname, err := resolve(session.roomname, guid)
+	if err == nil {
+		err = validateRoomName(roomname)
+	}
+	if err != nil {
+		return "", err
+	}
+	// A session has one subscription per room
+	if roomname == session.roomname {
+		return "", fmt.Errorf("room %s is open as the room of the session", roomname)
+	}
+	for open, r := range session.subdocs {
+		if r == roomname {
+			return "", fmt.Errorf("room %s is open as subdocument %s", roomname, open)
+		}
+	}
+	return roomname, nil
+}
+
+// closeSubdocs closes every subdocument of the session, which can't open
+// new ones afterwards.
+func (s *session) closeSubdocs(ydb *Ydb) {
+	s.subdocsMux.Lock()
+	subdocs := s.subdocs
+	s.subdocs = nil
+	s.subdocsClosed = true
+	s.subdocsMux.Unlock()
+	for _, roomname := range subdocs {
+		ydb.broadcaster.Unsubscribe(roomname, s.sessionid)
+	}
+}
+
+// dropSubdoc closes the subdocuments stored in the room name for every
+// session and tells their clients.
+func (ydb *Ydb) dropSubdoc(name YjsRoomName) {
+	ydb.sessionsMux.Lock()
+	sessions := make([]*session, 0, len(ydb.sessions))
+	for _, s := range ydb.sessions {
+		sessions = append(sessions, s)
+	}
+	ydb.sessionsMux.Unlock()
+	for _, s := range sessions {
+		s.subdocsMux.Lock()
+		var closed []string
+		for guid, roomname := range s.subdocs {
+			if roomname == name {
+				closed = append(closed, guid)
+				delete(s.subdocs, guid)
+			}
+		}
+		s.subdocsMux.Unlock()
+		if len(closed) > 0 {
+			ydb.broadcaster.Unsubscribe(name, s.sessionid)
+		}
+		for _, guid := range closed {
+			s.send(createMessageSubdocClose(guid))
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// parseSubdocMessage returns the GUID and the inner message of a
+// messageSubdoc, or only the GUID of a messageSubdocClose.
+func parseSubdocMessage(t *testing.T, msg []byte) (msgType uint64, guid string, inner []byte) {
+	t.Helper()
+	buf := bytes.NewBuffer(msg)
+	msgType, err := binary.ReadUvarint(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != messageSubdoc && msgType != messageSubdocClose {
+		t.Fatalf("not a subdocument message: %v", msg)
+	}
+	if guid, err = readString(buf); err != nil {
+		t.Fatal(err)
+	}
+	if msgType == messageSubdoc {
+		if inner, err = readPayload(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return msgType, guid, inner
+}
+
+func (c *testWsClient) sendSubdoc(guid string, m []byte) {
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, createMessageSubdoc(guid, m)); err != nil {
+		c.t.Fatalf("sendSubdoc failed: %v", err)
+	}
+}
+
+func TestSubdocSync(t *testing.T) {
+	ts := newTestServer(t)
+	a := ts.dial(t, "workspace")
+	b := ts.dial(t, "workspace")
+
+	page := testUpdate([]testItem{{client: 1, root: "text", text: "page"}})
+	a.sendSubdoc("page1", makeYjsSyncUpdate(page))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("workspace~page1")
+		return size > 0
+	})
+	if size, _ := ts.store.Size("workspace"); size != 0 {
+		t.Fatalf("subdocument update was written to the root room (%d bytes)", size)
+	}
+
+	// Opening replays the log of the subdocument
+	b.sendSubdoc("page1", nil)
+	msg, ok := b.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("expected the subdocument log")
+	}
+	msgType, guid, inner := parseSubdocMessage(t, msg)
+	if msgType != messageSubdoc || guid != "page1" {
+		t.Fatalf("unexpected message %d for %q", msgType, guid)
+	}
+	if _, payload, err := parseSyncMessage(inner); err != nil || !bytes.Equal(payload, page) {
+		t.Fatalf("unexpected subdocument message %v: %v", inner, err)
+	}
+
+	// Live updates go to the other sessions that opened the subdocument
+	edit := testUpdate([]testItem{{client: 2, root: "text", text: "!"}})
+	a.sendSubdoc("page1", makeYjsSyncUpdate(edit))
+	msg, ok = b.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("expected the live update")
+	}
+	if _, guid, inner = parseSubdocMessage(t, msg); guid != "page1" {
+		t.Fatalf("update for %q", guid)
+	}
+	if _, payload, _ := parseSyncMessage(inner); !bytes.Equal(payload, edit) {
+		t.Fatalf("unexpected update %v", payload)
+	}
+	if msgs := a.recvAll(200 * time.Millisecond); len(msgs) != 0 {
+		t.Fatalf("the sender received %d messages", len(msgs))
+	}
+
+	// Closed subdocuments receive nothing
+	b.conn.WriteMessage(websocket.BinaryMessage, createMessageSubdocClose("page1"))
+	time.Sleep(100 * time.Millisecond)
+	a.sendSubdoc("page1", makeYjsSyncUpdate(testUpdate([]testItem{{client: 3, root: "text", text: "?"}})))
+	if msgs := b.recvAll(200 * time.Millisecond); len(msgs) != 0 {
+		t.Fatalf("closed subdocument received %d messages", len(msgs))
+	}
+}
+
+func TestSubdocRefused(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxSubdocs = 1
+	ts := newTestServerWithConfig(t, cfg)
+	c := ts.dial(t, "workspace")
+
+	c.sendSubdoc("page1", nil)
+	c.sendSubdoc("page2", nil)
+	c.sendSubdoc("", nil)
+	for _, want := range []string{"page2", ""} {
+		msg, ok := c.recv(2 * time.Second)
+		if !ok {
+			t.Fatalf("expected %q to be closed", want)
+		}
+		if msgType, guid, _ := parseSubdocMessage(t, msg); msgType != messageSubdocClose || guid != want {
+			t.Fatalf("got message %d for %q, want close of %q", msgType, guid, want)
+		}
+	}
+}
+
+func TestSubdocEvicted(t *testing.T) {
+	ts := newDiskTestServer(t)
+	c := ts.dial(t, "workspace")
+	if err := ts.ydb.Edit("workspace~page1", func(doc *Doc) error { return doc.GetText("text").Insert(0, "page") }); err != nil {
+		t.Fatal(err)
+	}
+
+	c.sendSubdoc("page1", nil)
+	if _, ok := c.recv(2 * time.Second); !ok {
+		t.Fatal("expected the subdocument log")
+	}
+	if err := ts.ydb.DeleteRoom("workspace~page1"); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := c.recv(2 * time.Second)
+	if !ok {
+		t.Fatal("expected the subdocument to be closed")
+	}
+	if msgType, guid, _ := parseSubdocMessage(t, msg); msgType != messageSubdocClose || guid != "page1" {
+		t.Fatalf("got message %d for %q", msgType, guid)
+	}
+	// The session of the root room stays open
+	if _, closed := c.waitClosed(100 * time.Millisecond); closed {
+		t.Fatal("the session was closed")
+	}
+}
+
+func TestSubdocDiskStore(t *testing.T) {
+	ts := newDiskTestServer(t)
+	if err := ts.ydb.Edit("workspace", func(doc *Doc) error { return doc.GetText("text").Insert(0, "root") }); err != nil {
+		t.Fatal(err)
+	}
+	c := ts.dial(t, "workspace")
+	c.sendSubdoc("page1", makeYjsSyncUpdate(testUpdate([]testItem{{client: 1, root: "text", text: "page"}})))
+	c.sendSubdoc("dir/page2", makeYjsSyncUpdate(testUpdate([]testItem{{client: 1, root: "text", text: "nested"}})))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("workspace~dir%2Fpage2")
+		return size > 0
+	})
+	if err := ts.ydb.Edit("workspace", func(doc *Doc) error { return doc.GetText("text").Insert(4, "!") }); err != nil {
+		t.Fatal(err)
+	}
+	for room, want := range map[YjsRoomName]string{"workspace": "root!", "workspace~page1": "page", "workspace~dir%2Fpage2": "nested"} {
+		if got, err := ts.ydb.RoomJSON(room); err != nil || got["text"] != want {
+			t.Errorf("room %s has %v (%v), want %q", room, got, err, want)
+		}
+	}
+}
+
+func TestSubdocResolver(t *testing.T) {
+	ts := newTestServer(t)
+	ts.httpServer.Config.Handler.(*http.ServeMux).Handle("/docs/", NewWsHandler(ts.ydb, WithRoomPathPrefix("/docs/"), WithSubdocResolver(func(root YjsRoomName, guid string) (YjsRoomName, error) {
+		return "subdocs/" + YjsRoomName(guid), nil
+	})))
+	c := ts.dialPath(t, "/docs/", "workspace")
+	c.sendSubdoc("page1", makeYjsSyncUpdate(testUpdate([]testItem{{client: 1, root: "text", text: "page"}})))
+	waitFor(t, 2*time.Second, func() bool {
+		size, _ := ts.store.Size("subdocs/page1")
+		return size > 0
+	})
+}
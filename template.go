@@ -0,0 +1,76 @@
+package ydb
+
+import "fmt"
+
+// CreateRoom creates a room with a Yjs update as content. It fails with
+// ErrRoomExists if the room already has content; use ReplaceRoomContent to
+// overwrite a room. Rooms that clients only connected to count as empty.
+//
+// Unlike the initial content of a DiskStore, the content is written like any
+// other update: it passes the interceptors, is journaled and audited, and is
+// broadcast to sessions already connected to the empty room.
+func (ydb *Ydb) CreateRoom(name YjsRoomName, update []byte) error {
+	if err := NewDoc().ApplyUpdate(update); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUpdate, err)
+	}
+	err := ydb.updateRoomIf(name, nil, encodeSyncMessage(messageYjsUpdate, update), func() error {
+		data, err := ydb.RoomLog(name)
+		if err != nil {
+			return err
+		}
+		doc, err := docFromLog(data)
+		if err != nil {
+			return err
+		}
+		if len(doc.stateVector()) > 0 {
+			return ErrRoomExists
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ydb.log.Info("room created", "room", name, "size", len(update))
+	return nil
+}
+
+// CreateRoomFrom creates the room dst with the current content of src, e.g. a
+// template room. It fails with ErrRoomExists if dst already has content. The
+// copy keeps the Yjs identity of the content, so updates made to one room
+// can be applied to the other.
+func (ydb *Ydb) CreateRoomFrom(src, dst YjsRoomName) error {
+	data, err := ydb.RoomLog(src)
+	if err != nil {
+		return err
+	}
+	return ydb.createRoomFromLog(src, dst, data)
+}
+
+// CreateRoomAt creates the room dst with the content src had when its log ended
+// at offset, which must be a message boundary such as the Offset of a
+// Version. It fails with ErrRoomExists if dst already has content.
+func (ydb *Ydb) CreateRoomAt(src, dst YjsRoomName, offset uint32) error {
+	data, err := ydb.RoomLog(src)
+	if err != nil {
+		return err
+	}
+	if data, err = logPrefix(data, offset); err != nil {
+		return err
+	}
+	return ydb.createRoomFromLog(src, dst, data)
+}
+
+func (ydb *Ydb) createRoomFromLog(src, dst YjsRoomName, data []byte) error {
+	doc, err := docFromLog(data)
+	if err != nil {
+		return err
+	}
+	if len(doc.stateVector()) == 0 {
+		return fmt.Errorf("%w: %s has no content", ErrRoomNotFound, src)
+	}
+	update, err := doc.EncodeStateAsUpdate(nil)
+	if err != nil {
+		return err
+	}
+	return ydb.CreateRoom(dst, update)
+}
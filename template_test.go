@@ -0,0 +1,96 @@
+package ydb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateRoomFrom(t *testing.T) {
+	ts := newTestServer(t)
+	template := testUpdate([]testItem{{client: 1, root: "text", text: "template"}})
+	if err := ts.ydb.CreateRoom("template", template); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.ydb.CreateRoom("template", template); !errors.Is(err, ErrRoomExists) {
+		t.Fatalf("expected ErrRoomExists, got %v", err)
+	}
+	if err := ts.ydb.CreateRoom("other", []byte{1, 2, 3}); !errors.Is(err, ErrInvalidUpdate) {
+		t.Fatalf("expected ErrInvalidUpdate, got %v", err)
+	}
+
+	// A session waiting in the empty room receives the copied content
+	client := ts.dial(t, "copy")
+	client.sendSyncStep1([]byte{0})
+	client.recvAll(200 * time.Millisecond)
+	if err := ts.ydb.CreateRoomFrom("template", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.recv(2 * time.Second); !ok {
+		t.Fatal("expected the content to be broadcast")
+	}
+	want, _ := ts.ydb.RoomJSON("template")
+	if got, _ := ts.ydb.RoomJSON("copy"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("copy has %v, want %v", got, want)
+	}
+	if err := ts.ydb.CreateRoomFrom("template", "copy"); !errors.Is(err, ErrRoomExists) {
+		t.Fatalf("expected ErrRoomExists, got %v", err)
+	}
+	if err := ts.ydb.CreateRoomFrom("missing", "other"); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+}
+
+func TestCreateRoomAt(t *testing.T) {
+	ts := newTestServer(t)
+	ts.ydb.Edit("room", func(doc *Doc) error { return doc.GetText("text").Insert(0, "v1") })
+	offset, _ := ts.store.Size("room")
+	ts.ydb.Edit("room", func(doc *Doc) error { return doc.GetText("text").Insert(2, " and v2") })
+
+	if err := ts.ydb.CreateRoomAt("room", "copy", offset); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ts.ydb.RoomJSON("copy"); got["text"] != "v1" {
+		t.Fatalf("unexpected copy content %v", got)
+	}
+	if err := ts.ydb.CreateRoomAt("room", "other", offset-1); !errors.Is(err, ErrInvalidOffset) {
+		t.Fatalf("expected ErrInvalidOffset, got %v", err)
+	}
+}
+
+func TestCliCopy(t *testing.T) {
+	ydbInstance, client := newAdminTestServer(t)
+	ydbInstance.Edit("room", func(doc *Doc) error { return doc.GetText("text").Insert(0, "a") })
+	offset, _ := ydbInstance.store.Size("room")
+	ydbInstance.Edit("room", func(doc *Doc) error { return doc.GetText("text").Insert(1, "b") })
+
+	if err := runCliCommand(client, "copy", "room", "copy", cliOptions{offset: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCliCommand(client, "copy", "room", "fork", cliOptions{offset: int64(offset)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ydbInstance.RoomJSON("copy"); got["text"] != "ab" {
+		t.Fatalf("unexpected copy %v", got)
+	}
+	if got, _ := ydbInstance.RoomJSON("fork"); got["text"] != "a" {
+		t.Fatalf("unexpected fork %v", got)
+	}
+	err := runCliCommand(client, "copy", "room", "copy", cliOptions{offset: -1})
+	if err == nil || !strings.Contains(err.Error(), "409") {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+
+	in := filepath.Join(t.TempDir(), "in.bin")
+	os.WriteFile(in, testUpdate([]testItem{{client: 1, root: "text", text: "new"}}), 0600)
+	if err := runCliCommand(client, "create", "new", in, cliOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCliCommand(client, "create", "new", in, cliOptions{}); err == nil {
+		t.Fatal("expected create to refuse a room with content")
+	}
+}
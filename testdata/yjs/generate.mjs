@@ -0,0 +1,105 @@
+// Generates updates.json, the Yjs updates that TestYjsGoldenUpdates decodes.
+// Run it with the Yjs release to check against:
+//
+//	npm install yjs@13 && node testdata/yjs/generate.mjs
+//
+// Every case records the updates of its transactions, in order, with the
+// JSON and the state vector of the resulting document.
+import * as Y from 'yjs'
+import { readFileSync, writeFileSync } from 'node:fs'
+
+const cases = []
+
+function record (name, opts, fn) {
+  const doc = new Y.Doc(opts)
+  doc.clientID = 1
+  const updates = []
+  doc.on('update', update => updates.push(Buffer.from(update).toString('base64')))
+  fn(doc)
+  cases.push({
+    name,
+    updates,
+    full: Buffer.from(Y.encodeStateAsUpdate(doc)).toString('base64'),
+    stateVector: Buffer.from(Y.encodeStateVector(doc)).toString('base64'),
+    json: doc.toJSON()
+  })
+}
+
+record('text', {}, doc => {
+  const text = doc.getText('text')
+  text.insert(0, 'hello')
+  text.insert(5, ' world')
+  text.insert(0, 'ünïcödé 👋 ')
+})
+
+record('text deletes', { gc: false }, doc => {
+  const text = doc.getText('text')
+  text.insert(0, 'hello brave new world')
+  text.delete(6, 6)
+  text.delete(0, 1)
+  text.insert(0, 'H')
+})
+
+record('map', {}, doc => {
+  const map = doc.getMap('map')
+  map.set('number', 42)
+  map.set('float', 1.5)
+  map.set('string', 'value')
+  map.set('bool', true)
+  map.set('null', null)
+  map.set('object', { a: 1, b: ['x', { c: false }] })
+  map.set('array', [1, 'two', 3])
+  map.set('string', 'overwritten')
+  map.delete('bool')
+})
+
+record('array', {}, doc => {
+  const array = doc.getArray('array')
+  array.push([1, 'two', { three: 3 }])
+  array.insert(1, ['inserted'])
+  array.delete(0, 1)
+  array.push([[4, 5]])
+})
+
+record('nested types', {}, doc => {
+  const map = doc.getMap('root')
+  const text = new Y.Text()
+  map.set('text', text)
+  text.insert(0, 'nested text')
+  const list = new Y.Array()
+  map.set('list', list)
+  const item = new Y.Map()
+  list.push([item])
+  item.set('done', false)
+  item.set('title', 'first')
+})
+
+record('gc structs', { gc: true }, doc => {
+  const map = doc.getMap('map')
+  const nested = new Y.Map()
+  map.set('nested', nested)
+  nested.set('a', 'content')
+  nested.set('b', new Y.Array())
+  map.delete('nested')
+  const text = doc.getText('text')
+  text.insert(0, 'abcdef')
+  text.delete(1, 4)
+})
+
+record('concurrent', {}, doc => {
+  const other = new Y.Doc()
+  other.clientID = 2
+  doc.getText('text').insert(0, 'one')
+  Y.applyUpdate(other, Y.encodeStateAsUpdate(doc))
+  doc.getText('text').insert(3, ' from 1')
+  other.getText('text').insert(3, ' from 2')
+  other.getText('text').delete(0, 1)
+  Y.applyUpdate(doc, Y.encodeStateAsUpdate(other, Y.encodeStateVector(doc)))
+})
+
+let version = 'unknown'
+try {
+  version = JSON.parse(readFileSync('node_modules/yjs/package.json')).version
+} catch {}
+const file = new URL('updates.json', import.meta.url)
+writeFileSync(file, JSON.stringify({ yjs: version, cases }, null, 2) + '\n')
@@ -72,11 +72,39 @@ func (ms *MemoryStore) SetInitialContent(room YjsRoomName, data []byte) error {
 	return nil
 }
 
+func (ms *MemoryStore) Delete(room YjsRoomName) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.data[room]; !ok {
+		return ErrRoomNotFound
+	}
+	delete(ms.data, room)
+	return nil
+}
+
+func (ms *MemoryStore) Rename(from, to YjsRoomName) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	d, ok := ms.data[from]
+	if !ok {
+		return ErrRoomNotFound
+	}
+	if len(ms.data[to]) > 0 {
+		return ErrRoomExists
+	}
+	delete(ms.data, from)
+	ms.data[to] = d
+	return nil
+}
+
 // --- mockConn ---
 
 type mockConn struct {
-	mu       sync.Mutex
-	messages [][]byte
+	mu         sync.Mutex
+	messages   [][]byte
+	closeCode  int
+	closeText  string
+	closeCalls int
 }
 
 func (mc *mockConn) WriteMessage(m []byte, pm *websocket.PreparedMessage) {
@@ -87,6 +115,20 @@ func (mc *mockConn) WriteMessage(m []byte, pm *websocket.PreparedMessage) {
 	mc.mu.Unlock()
 }
 
+func (mc *mockConn) Close(code int, reason string) {
+	mc.mu.Lock()
+	mc.closeCode = code
+	mc.closeText = reason
+	mc.closeCalls++
+	mc.mu.Unlock()
+}
+
+func (mc *mockConn) getClose() (code int, reason string, calls int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.closeCode, mc.closeText, mc.closeCalls
+}
+
 func (mc *mockConn) getMessages() [][]byte {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
@@ -148,6 +190,12 @@ func newTestServerWithComponents(t *testing.T, store Store, broadcaster Broadcas
 	mux.HandleFunc("/readonly/", func(w http.ResponseWriter, r *http.Request) {
 		YdbWsConnectionHandler(ydbInstance)(w, r.WithContext(WithReadOnlySession(r.Context())))
 	})
+	mux.Handle("/tree/", NewWsHandler(ydbInstance, WithRoomPathPrefix("/tree/")))
+	mux.Handle("/rest/", NewRestHandler(ydbInstance, WithRoomPathPrefix("/rest/")))
+	mux.Handle("/events/", NewSSEHandler(ydbInstance, WithRoomPathPrefix("/events/"), WithHeartbeatInterval(100*time.Millisecond)))
+	mux.Handle("/rest-readonly/", http.StripPrefix("/rest-readonly", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewRestHandler(ydbInstance, WithRoomPathPrefix("/")).ServeHTTP(w, r.WithContext(WithReadOnlySession(r.Context())))
+	})))
 
 	server := httptest.NewServer(mux)
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
@@ -175,6 +223,7 @@ type testWsClient struct {
 	conn     *websocket.Conn
 	received chan []byte
 	done     chan struct{}
+	readErr  error
 }
 
 func (ts *testServer) dial(t *testing.T, roomname string) *testWsClient {
@@ -204,6 +253,7 @@ func (ts *testServer) dialPath(t *testing.T, path string, roomname string) *test
 		for {
 			_, msg, err := conn.ReadMessage()
 			if err != nil {
+				c.readErr = err
 				return
 			}
 			c.received <- msg
@@ -260,6 +310,16 @@ func (c *testWsClient) recvAll(timeout time.Duration) [][]byte {
 	}
 }
 
+// waitClosed waits for the server to close the connection and returns the read error.
+func (c *testWsClient) waitClosed(timeout time.Duration) (error, bool) {
+	select {
+	case <-c.done:
+		return c.readErr, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
 func (c *testWsClient) close() {
 	c.conn.Close()
 	<-c.done
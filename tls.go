@@ -0,0 +1,120 @@
+package ydb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// tlsVersion is a TLS protocol version that reads and prints as "1.2".
+type tlsVersion uint16
+
+var tlsVersionNames = map[tlsVersion]string{
+	tls.VersionTLS10: "1.0",
+	tls.VersionTLS11: "1.1",
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS13: "1.3",
+}
+
+func (v tlsVersion) MarshalText() ([]byte, error) {
+	if name, ok := tlsVersionNames[v]; ok {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unknown TLS version %#x", uint16(v))
+}
+
+func (v *tlsVersion) UnmarshalText(text []byte) error {
+	for version, name := range tlsVersionNames {
+		if strings.TrimPrefix(strings.ToLower(string(text)), "tls") == name {
+			*v = version
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", text)
+}
+
+// tlsReloader serves TLS with certificates loaded from files. reload re-reads
+// the files; handshakes after a successful reload use the new certificates,
+// while established connections are not affected.
+type tlsReloader struct {
+	certFile, keyFile string
+	clientCAFile      string
+	minVersion        tlsVersion
+	current           atomic.Pointer[tls.Config]
+}
+
+func newTLSReloader(sc *startConfig) (*tlsReloader, error) {
+	if sc.TLSClientCA != "" && (sc.TLSCert == "" || sc.TLSKey == "") {
+		return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+	if sc.TLSCert == "" || sc.TLSKey == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	r := &tlsReloader{
+		certFile:     sc.TLSCert,
+		keyFile:      sc.TLSKey,
+		clientCAFile: sc.TLSClientCA,
+		minVersion:   sc.TLSMinVersion,
+	}
+	return r, r.reload()
+}
+
+func (r *tlsReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   uint16(r.minVersion),
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found", r.clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.current.Store(cfg)
+	return nil
+}
+
+// serverConfig returns the tls.Config to install on an http.Server.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: uint16(r.minVersion),
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// clientCertPrincipal returns the identity of a verified TLS client
+// certificate: its common name, or else its first DNS name or email address.
+func clientCertPrincipal(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+package ydb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	if err := os.WriteFile(certFile, c.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func startTestTLSServer(t *testing.T, reloader *tlsReloader) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, clientCertPrincipal(r))
+	}))
+	server.TLS = reloader.serverConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTLSReloadAndClientCertPrincipal(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test ca", 1, nil)
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	newTestCert(t, "server", 2, ca).write(t, certFile, keyFile)
+	os.WriteFile(caFile, ca.certPEM, 0600)
+
+	sc := defaultStartConfig()
+	sc.TLSCert, sc.TLSKey, sc.TLSClientCA = certFile, keyFile, caFile
+	reloader, err := newTLSReloader(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startTestTLSServer(t, reloader)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert := newTestCert(t, "alice", 3, ca).tlsCertificate(t)
+	get := func(certs []tls.Certificate) (string, *big.Int, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2, got %s", resp.Proto)
+		}
+		return string(body), resp.TLS.PeerCertificates[0].SerialNumber, nil
+	}
+
+	principal, serial, err := get([]tls.Certificate{clientCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal != "alice" || serial.Int64() != 2 {
+		t.Fatalf("principal %q, serial %v", principal, serial)
+	}
+	if _, _, err := get(nil); err == nil {
+		t.Fatal("expected the handshake to fail without a client certificate")
+	}
+
+	// A new certificate is used for new connections after reload
+	newTestCert(t, "server", 4, ca).write(t, certFile, keyFile)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, serial, err = get([]tls.Certificate{clientCert}); err != nil || serial.Int64() != 4 {
+		t.Fatalf("expected reloaded certificate, got serial %v (%v)", serial, err)
+	}
+
+	// A broken file keeps the current certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	if err := reloader.reload(); err == nil {
+		t.Fatal("expected reload to fail")
+	}
+	if _, serial, err = get([]tls.Certificate{clientCert}); err != nil || serial.Int64() != 4 {
+		t.Fatalf("expected previous certificate, got serial %v (%v)", serial, err)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	newTestCert(t, "server", 1, nil).write(t, certFile, keyFile)
+
+	sc := defaultStartConfig()
+	sc.TLSCert, sc.TLSKey = certFile, keyFile
+	if err := sc.TLSMinVersion.UnmarshalText([]byte("1.3")); err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := newTLSReloader(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startTestTLSServer(t, reloader)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	}}}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("expected a TLS 1.2 client to be rejected")
+	}
+}
+
+func TestTLSReloaderRequiresCertAndKey(t *testing.T) {
+	sc := defaultStartConfig()
+	sc.TLSClientCA = "ca.pem"
+	if _, err := newTLSReloader(&sc); err == nil {
+		t.Fatal("expected an error for --tls-client-ca without a certificate")
+	}
+	sc = defaultStartConfig()
+	sc.TLSCert = "cert.pem"
+	if _, err := newTLSReloader(&sc); err == nil {
+		t.Fatal("expected an error for --tls-cert without --tls-key")
+	}
+}
@@ -0,0 +1,231 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// ErrInvalidOffset is returned for offsets that don't fall between two messages of a room log.
+var ErrInvalidOffset = errors.New("offset is not a message boundary of the room log")
+
+// CreateVersion records the current end of the room log as a named version.
+// The store must implement VersionStore.
+func (ydb *Ydb) CreateVersion(name YjsRoomName, version, author string) (Version, error) {
+	vs, ok := ydb.store.(VersionStore)
+	if !ok {
+		return Version{}, ErrNotSupported
+	}
+	if version == "" {
+		return Version{}, errors.New("version name must not be empty")
+	}
+	offset, err := ydb.store.Size(name)
+	if err != nil {
+		return Version{}, err
+	}
+	v := Version{Name: version, Offset: offset, Time: time.Now().UTC(), Author: author}
+	if err := vs.AddVersion(name, v); err != nil {
+		return Version{}, err
+	}
+	ydb.log.Info("version created", "room", name, "version", version, "offset", offset, "author", author)
+	return v, nil
+}
+
+// Versions lists the versions of a room in the order they were created.
+func (ydb *Ydb) Versions(name YjsRoomName) ([]Version, error) {
+	vs, ok := ydb.store.(VersionStore)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return vs.Versions(name)
+}
+
+// DocAt returns the content of a room as it was when its log ended at offset,
+// e.g. the Offset of a Version.
+func (ydb *Ydb) DocAt(name YjsRoomName, offset uint32) (*Doc, error) {
+	data, err := ydb.RoomLog(name)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := logPrefix(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	return docFromLog(prefix)
+}
+
+// RestoreRoom brings a room back to its content at offset. Since Yjs history
+// can't be undone, it writes an update that deletes what was added after
+// offset and inserts copies of what was deleted since. Connected clients
+// receive the update like any other and converge to the old content; the log
+// keeps the complete history.
+func (ydb *Ydb) RestoreRoom(name YjsRoomName, offset uint32) error {
+	data, err := ydb.RoomLog(name)
+	if err != nil {
+		return err
+	}
+	prefix, err := logPrefix(data, offset)
+	if err != nil {
+		return err
+	}
+	old, err := docFromLog(prefix)
+	if err != nil {
+		return err
+	}
+	doc, err := docFromLog(data)
+	if err != nil {
+		return err
+	}
+	update, err := doc.Transact(func() error { return doc.revertTo(old) })
+	if err != nil || update == nil {
+		return err
+	}
+	ydb.log.Info("room restored", "room", name, "offset", offset)
+	return ydb.updateRoom(name, nil, encodeSyncMessage(messageYjsUpdate, update))
+}
+
+// logPrefix returns the log up to offset, which must be the start of a message or the end of the log.
+func logPrefix(data []byte, offset uint32) ([]byte, error) {
+	if int(offset) == len(data) {
+		return data, nil
+	}
+	entries, err := decodeRoomLog(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Offset == offset {
+			return data[:offset], nil
+		}
+	}
+	return nil, ErrInvalidOffset
+}
+
+// revertTo makes the document show the content of old, an earlier state of
+// the same document: items added since are deleted, and copies of items
+// deleted since are inserted next to them.
+func (d *Doc) revertTo(old *Doc) error {
+	for _, t := range d.share {
+		if err := d.revertType(t, old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visibleIn returns the struct of old holding id if it wasn't deleted there.
+func visibleIn(old *Doc, id yID) *yItem {
+	o := old.find(id)
+	if o == nil || o.gc || o.deleted {
+		return nil
+	}
+	return o
+}
+
+func (d *Doc) revertType(t *yType, old *Doc) error {
+	for item := t.start; item != nil; {
+		next := item.right
+		o := visibleIn(old, item.id)
+		switch {
+		case !item.deleted && o == nil:
+			d.deleteItem(item)
+		case item.deleted && o != nil && !item.gc:
+			if _, err := d.insertCopy(t, item, nil, o, item.id.clock-o.id.clock, item.length); err != nil {
+				return err
+			}
+		case !item.deleted && o != nil:
+			if ct, ok := item.content.(*contentType); ok {
+				if err := d.revertType(ct.typ, old); err != nil {
+					return err
+				}
+			}
+		}
+		item = next
+	}
+
+	keys := make([]string, 0, len(t.keys))
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		cur := t.keys[key]
+		// The old value is the rightmost item of the key that old knows
+		var oldItem *yItem
+		for it := cur; it != nil; it = it.left {
+			if old.find(it.id) != nil {
+				oldItem = it
+				break
+			}
+		}
+		var o *yItem
+		if oldItem != nil {
+			o = visibleIn(old, oldItem.id)
+		}
+		switch {
+		case o == nil:
+			d.deleteItem(cur)
+		case oldItem == cur && !cur.deleted:
+			if ct, ok := cur.content.(*contentType); ok {
+				if err := d.revertType(ct.typ, old); err != nil {
+					return err
+				}
+			}
+		default:
+			if _, err := d.insertCopy(t, nil, &key, o, oldItem.id.clock-o.id.clock, oldItem.length); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertCopy inserts a copy of length units of the old struct o, starting at
+// offset, like insertLocal. Nested types are copied with their content.
+func (d *Doc) insertCopy(parent *yType, left *yItem, key *string, o *yItem, offset, length uint64) (*yItem, error) {
+	content, err := cloneContent(o.content, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	item := d.insertLocal(parent, left, key, content)
+	if ct, ok := content.(*contentType); ok {
+		return item, d.copyType(ct.typ, o.content.(*contentType).typ)
+	}
+	return item, nil
+}
+
+// copyType fills the new type dst with copies of the visible content of src.
+func (d *Doc) copyType(dst, src *yType) error {
+	var left *yItem
+	for o := src.start; o != nil; o = o.right {
+		if o.deleted || o.gc {
+			continue
+		}
+		var err error
+		if left, err = d.insertCopy(dst, left, nil, o, 0, o.length); err != nil {
+			return err
+		}
+	}
+	for key, o := range src.keys {
+		if o.deleted || o.gc {
+			continue
+		}
+		if _, err := d.insertCopy(dst, nil, &key, o, 0, o.length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneContent copies length units of c starting at offset.
+func cloneContent(c yContent, offset, length uint64) (yContent, error) {
+	buf := &bytes.Buffer{}
+	c.write(buf, offset)
+	clone, err := readContent(newYDecoder(buf.Bytes()), c.ref())
+	if err != nil {
+		return nil, err
+	}
+	if clone.len() > length {
+		clone.splice(length)
+	}
+	return clone, nil
+}
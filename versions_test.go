@@ -0,0 +1,126 @@
+package ydb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRestoreRoom(t *testing.T) {
+	ts := newTestServerWithComponents(t, NewDiskStore(t.TempDir()), NewLocalBroadcaster(64), DefaultConfig())
+	edit := func(fn func(doc *Doc) error) {
+		t.Helper()
+		if err := ts.ydb.Edit("room", fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit(func(doc *Doc) error {
+		meta := doc.GetMap("meta")
+		meta.Set("title", "A")
+		meta.SetMap("owner").Set("name", "alice")
+		doc.GetArray("list").Push(1, 2)
+		return doc.GetText("text").Insert(0, "hello world")
+	})
+	v1, err := ts.ydb.CreateVersion("room", "v1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(func(doc *Doc) error {
+		meta := doc.GetMap("meta")
+		meta.Set("title", "B")
+		meta.Set("added", true)
+		meta.Delete("owner")
+		list := doc.GetArray("list")
+		list.Push(3)
+		list.Delete(0, 1)
+		text := doc.GetText("text")
+		text.Delete(2, 6)
+		return text.Insert(0, "big ")
+	})
+	edit(func(doc *Doc) error { return doc.GetArray("later").Push("x") })
+
+	old, err := ts.ydb.DocAt("room", v1.Offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := old.ToJSON()
+	if want["text"] != "hello world" {
+		t.Fatalf("unexpected content at v1: %v", want)
+	}
+
+	client := ts.dial(t, "room")
+	client.sendSyncStep1([]byte{0})
+	client.recvAll(200 * time.Millisecond)
+	if err := ts.ydb.RestoreRoom("room", v1.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.recv(2 * time.Second); !ok {
+		t.Fatal("expected the reverting update to be broadcast")
+	}
+	got, err := ts.ydb.RoomJSON("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Roots created after v1 remain, empty
+	want["later"] = []any{}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored content %v, want %v", got, want)
+	}
+
+	if err := ts.ydb.RestoreRoom("room", v1.Offset+1); !errors.Is(err, ErrInvalidOffset) {
+		t.Fatalf("expected ErrInvalidOffset, got %v", err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	store := NewDiskStore(t.TempDir())
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	ydbInstance.Edit("a", func(doc *Doc) error { return doc.GetText("t").Insert(0, "x") })
+
+	if _, err := ydbInstance.CreateVersion("a", "v1", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ydbInstance.CreateVersion("a", "v1", "bob"); !errors.Is(err, ErrVersionExists) {
+		t.Fatalf("expected ErrVersionExists, got %v", err)
+	}
+	ydbInstance.Edit("a", func(doc *Doc) error { return doc.GetText("t").Insert(0, "y") })
+	ydbInstance.CreateVersion("a", "v2", "")
+	versions, err := ydbInstance.Versions("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Name != "v1" || versions[0].Author != "bob" || versions[1].Offset <= versions[0].Offset {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+
+	if err := ydbInstance.RenameRoom("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := ydbInstance.Versions("b"); len(versions) != 2 {
+		t.Fatal("expected versions to move with the room")
+	}
+	if versions, _ := ydbInstance.Versions("a"); len(versions) != 0 {
+		t.Fatal("expected no versions left at the old name")
+	}
+	if err := ydbInstance.ReplaceRoomContent("b", testUpdate([]testItem{{client: 1, root: "t", text: "new"}})); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := ydbInstance.Versions("b"); len(versions) != 0 {
+		t.Fatal("expected replacing the content to drop the versions")
+	}
+	ydbInstance.CreateVersion("b", "v3", "")
+	if err := ydbInstance.DeleteRoom("b"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := ydbInstance.Versions("b"); len(versions) != 0 {
+		t.Fatal("expected deleting the room to delete its versions")
+	}
+
+	memory := InitYdb(newMemoryStore(), NewLocalBroadcaster(64), DefaultConfig())
+	defer memory.Close()
+	if _, err := memory.CreateVersion("a", "v1", ""); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
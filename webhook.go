@@ -0,0 +1,424 @@
+package ydb
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the request body, keyed
+// with the secret of the webhook, as "sha256=<hex>".
+const webhookSignatureHeader = "Ydb-Signature"
+
+// Webhook is an endpoint that receives change notifications. Requests are
+// signed with Secret unless it is empty.
+type Webhook struct {
+	URL    string
+	Secret string
+}
+
+// WebhookOptions configures a WebhookDispatcher. Zero values use the defaults.
+type WebhookOptions struct {
+	Webhooks []Webhook
+	// Debounce is how long changes to a room are collected into one
+	// notification, counted from the first change. Defaults to 1s.
+	Debounce time.Duration
+	// MaxAttempts is how often a notification is sent before it is dropped.
+	// Defaults to 10.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay before a retry, which doubles
+	// with every failed attempt. Default to 1s and 5m.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// QueueDir, if set, persists notifications until they are delivered, so
+	// that they survive a restart. Notifications found there are resumed by
+	// NewWebhookDispatcher.
+	QueueDir string
+	// CloseTimeout is how long Close lets deliveries in flight finish.
+	// Defaults to 5s.
+	CloseTimeout time.Duration
+	// Client sends the requests; defaults to a client with a 10s timeout
+	Client *http.Client
+	Logger *slog.Logger
+}
+
+// WebhookNotification is the JSON body POSTed to webhooks. It describes the
+// changes of a room since the previous notification: the log grew by Bytes
+// from PreviousOffset to Offset through Updates updates. Authors lists the
+// principals of the sessions that wrote them. Retries can deliver
+// notifications out of order; Offset tells which one is the latest.
+type WebhookNotification struct {
+	Room           YjsRoomName `json:"room"`
+	Offset         uint32      `json:"offset"`
+	PreviousOffset uint32      `json:"previous_offset"`
+	Bytes          uint32      `json:"bytes"`
+	Updates        int         `json:"updates"`
+	Authors        []string    `json:"authors"`
+	Time           time.Time   `json:"time"`
+}
+
+// webhookDelivery is a notification on its way to one webhook, as persisted in the QueueDir.
+type webhookDelivery struct {
+	ID       string          `json:"id"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+	Attempts int             `json:"attempts"`
+}
+
+// webhookChange collects the updates of a room during the debounce interval.
+type webhookChange struct {
+	previousOffset uint32
+	offset         uint32
+	updates        int
+	authors        map[string]struct{}
+}
+
+// WebhookDispatcher POSTs debounced change notifications of rooms to
+// webhooks. Ydb passes it every persisted update, next to the EventHandler:
+//
+//	dispatcher, err := ydb.NewWebhookDispatcher(ydb.WebhookOptions{...})
+//	cfg.Webhooks = dispatcher
+type WebhookDispatcher struct {
+	opts    WebhookOptions
+	secrets map[string]string
+	log     *slog.Logger
+
+	mux     sync.Mutex
+	pending map[YjsRoomName]*webhookChange
+	timers  map[YjsRoomName]*time.Timer
+	closed  bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	seq    atomic.Uint64
+	failed atomic.Uint64
+}
+
+// NewWebhookDispatcher creates a dispatcher and resumes the notifications
+// persisted in opts.QueueDir.
+func NewWebhookDispatcher(opts WebhookOptions) (*WebhookDispatcher, error) {
+	if len(opts.Webhooks) == 0 {
+		return nil, errors.New("ydb: no webhooks configured")
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(5*time.Minute, opts.MinBackoff)
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = 5 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	d := &WebhookDispatcher{
+		opts:    opts,
+		secrets: make(map[string]string, len(opts.Webhooks)),
+		log:     newLogger(opts.Logger, new(slog.LevelVar)),
+		pending: make(map[YjsRoomName]*webhookChange),
+		timers:  make(map[YjsRoomName]*time.Timer),
+	}
+	for _, wh := range opts.Webhooks {
+		if !strings.HasPrefix(wh.URL, "http://") && !strings.HasPrefix(wh.URL, "https://") {
+			return nil, fmt.Errorf("ydb: invalid webhook URL %q", wh.URL)
+		}
+		d.secrets[wh.URL] = wh.Secret
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	if opts.QueueDir != "" {
+		if err := os.MkdirAll(opts.QueueDir, 0700); err != nil {
+			return nil, err
+		}
+		queued, err := d.loadQueue()
+		if err != nil {
+			return nil, err
+		}
+		for _, del := range queued {
+			d.start(del)
+		}
+	}
+	return d, nil
+}
+
+// update adds an update to the pending notification of its room. It is
+// called on the write path and must not block.
+func (d *WebhookDispatcher) update(ev UpdateEvent) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.closed {
+		return
+	}
+	// The event has the size of the sync message, the log holds it framed
+	framed := &bytes.Buffer{}
+	writeUvarint(framed, uint64(ev.Size))
+	start := ev.Offset - uint32(framed.Len()+ev.Size)
+	change := d.pending[ev.Room]
+	if change == nil {
+		change = &webhookChange{previousOffset: start, authors: map[string]struct{}{}}
+		d.pending[ev.Room] = change
+		d.timers[ev.Room] = time.AfterFunc(d.opts.Debounce, func() { d.flush(ev.Room) })
+	}
+	// Events of concurrent writers can arrive out of order
+	change.offset = max(change.offset, ev.Offset)
+	change.previousOffset = min(change.previousOffset, start)
+	change.updates++
+	if ev.Session.Principal != "" {
+		change.authors[ev.Session.Principal] = struct{}{}
+	}
+}
+
+// flush notifies the webhooks of the pending change of a room.
+func (d *WebhookDispatcher) flush(room YjsRoomName) {
+	d.mux.Lock()
+	change := d.pending[room]
+	delete(d.pending, room)
+	delete(d.timers, room)
+	if change != nil {
+		// Taken under the lock, so that Close waits for it
+		d.wg.Add(1)
+		defer d.wg.Done()
+	}
+	d.mux.Unlock()
+	if change != nil {
+		d.notify(room, change)
+	}
+}
+
+// notify turns a change into deliveries, one per webhook.
+func (d *WebhookDispatcher) notify(room YjsRoomName, change *webhookChange) {
+	n := WebhookNotification{
+		Room:           room,
+		Offset:         change.offset,
+		PreviousOffset: change.previousOffset,
+		Bytes:          change.offset - change.previousOffset,
+		Updates:        change.updates,
+		Authors:        make([]string, 0, len(change.authors)),
+		Time:           time.Now().UTC(),
+	}
+	for author := range change.authors {
+		n.Authors = append(n.Authors, author)
+	}
+	sort.Strings(n.Authors)
+	body, err := json.Marshal(n)
+	if err != nil {
+		d.log.Error("failed to encode webhook notification", "room", room, "error", err)
+		return
+	}
+	for _, wh := range d.opts.Webhooks {
+		del := &webhookDelivery{ID: d.newID(), URL: wh.URL, Body: body}
+		if err := d.persist(del); err != nil {
+			d.log.Error("failed to queue webhook notification", "room", room, "url", wh.URL, "error", err)
+		}
+		d.start(del)
+	}
+}
+
+// newID returns a queue file name that sorts in the order of creation.
+func (d *WebhookDispatcher) newID() string {
+	return fmt.Sprintf("%016x-%08x", time.Now().UnixNano(), d.seq.Add(1))
+}
+
+func (d *WebhookDispatcher) start(del *webhookDelivery) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(del)
+	}()
+}
+
+// deliver sends a notification until it succeeds, it ran out of attempts or
+// the dispatcher is closed. Closing leaves it in the queue.
+func (d *WebhookDispatcher) deliver(del *webhookDelivery) {
+	for {
+		err := d.send(del)
+		if err == nil {
+			d.remove(del)
+			return
+		}
+		if d.ctx.Err() != nil {
+			d.dropOnClose(del)
+			return
+		}
+		del.Attempts++
+		if del.Attempts >= d.opts.MaxAttempts {
+			d.failed.Add(1)
+			d.log.Error("dropping webhook notification", "url", del.URL, "attempts", del.Attempts, "error", err)
+			d.remove(del)
+			return
+		}
+		d.log.Warn("webhook delivery failed, retrying", "url", del.URL, "attempts", del.Attempts, "error", err)
+		d.persist(del)
+		select {
+		case <-d.ctx.Done():
+			d.dropOnClose(del)
+			return
+		case <-time.After(d.backoff(del.Attempts)):
+		}
+	}
+}
+
+// dropOnClose accounts for a delivery stopped by Close. A queued delivery is
+// resumed by the next dispatcher, others are lost.
+func (d *WebhookDispatcher) dropOnClose(del *webhookDelivery) {
+	if d.opts.QueueDir == "" {
+		d.failed.Add(1)
+		d.log.Warn("webhook notification not delivered before closing", "url", del.URL, "attempts", del.Attempts)
+	}
+}
+
+// backoff returns the delay before the next attempt after attempts failed ones.
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.MinBackoff
+	for i := 1; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.opts.MaxBackoff)
+}
+
+func (d *WebhookDispatcher) send(del *webhookDelivery) error {
+	secret, ok := d.secrets[del.URL]
+	if !ok {
+		// Queued for a webhook that is no longer configured
+		return nil
+	}
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, del.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ydb-Delivery", del.ID)
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, WebhookSignature(secret, del.Body))
+	}
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookSignature returns the Ydb-Signature header value of a request body,
+// for receivers to compare against with hmac.Equal.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *WebhookDispatcher) queuePath(del *webhookDelivery) string {
+	return filepath.Join(d.opts.QueueDir, del.ID+".json")
+}
+
+// persist writes a delivery to the queue, atomically replacing an older state.
+func (d *WebhookDispatcher) persist(del *webhookDelivery) error {
+	if d.opts.QueueDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(del)
+	if err != nil {
+		return err
+	}
+	tmp := d.queuePath(del) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.queuePath(del))
+}
+
+func (d *WebhookDispatcher) remove(del *webhookDelivery) {
+	if d.opts.QueueDir == "" {
+		return
+	}
+	if err := os.Remove(d.queuePath(del)); err != nil && !os.IsNotExist(err) {
+		d.log.Error("failed to remove webhook notification from the queue", "id", del.ID, "error", err)
+	}
+}
+
+// loadQueue reads the persisted deliveries in the order they were created.
+func (d *WebhookDispatcher) loadQueue() ([]*webhookDelivery, error) {
+	entries, err := os.ReadDir(d.opts.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	var queued []*webhookDelivery
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(d.opts.QueueDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		del := &webhookDelivery{}
+		if err := json.Unmarshal(data, del); err != nil {
+			return nil, fmt.Errorf("webhook queue entry %s: %w", e.Name(), err)
+		}
+		queued = append(queued, del)
+	}
+	return queued, nil
+}
+
+// FailedDeliveries returns the number of notifications dropped after
+// MaxAttempts, or by Close without a QueueDir.
+func (d *WebhookDispatcher) FailedDeliveries() uint64 {
+	return d.failed.Load()
+}
+
+// Close sends the pending notifications without waiting for the debounce
+// interval, gives deliveries CloseTimeout to finish and stops delivering.
+// Notifications that weren't delivered by then stay in the QueueDir for the
+// next dispatcher, or count as failed without one. Close the Ydb instance
+// first, so that no updates arrive meanwhile.
+func (d *WebhookDispatcher) Close() {
+	d.mux.Lock()
+	d.closed = true
+	pending := d.pending
+	for _, timer := range d.timers {
+		timer.Stop()
+	}
+	d.pending = map[YjsRoomName]*webhookChange{}
+	d.timers = map[YjsRoomName]*time.Timer{}
+	d.mux.Unlock()
+	for room, change := range pending {
+		d.notify(room, change)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	timeout := time.NewTimer(d.opts.CloseTimeout)
+	defer timeout.Stop()
+	select {
+	case <-done:
+	case <-timeout.C:
+	}
+	d.cancel()
+	<-done
+}
@@ -0,0 +1,169 @@
+package ydb
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the notifications POSTed to it, failing the first
+// failures requests.
+type webhookReceiver struct {
+	*httptest.Server
+	mux           sync.Mutex
+	failures      int
+	requests      int
+	notifications []WebhookNotification
+	received      chan struct{}
+}
+
+func newWebhookReceiver(t *testing.T, secret string, failures int) *webhookReceiver {
+	rcv := &webhookReceiver{failures: failures, received: make(chan struct{}, 16)}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if secret != "" && !hmac.Equal([]byte(r.Header.Get(webhookSignatureHeader)), []byte(WebhookSignature(secret, body))) {
+			t.Errorf("invalid signature %q", r.Header.Get(webhookSignatureHeader))
+		}
+		rcv.mux.Lock()
+		defer rcv.mux.Unlock()
+		rcv.requests++
+		if rcv.requests <= rcv.failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var n WebhookNotification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Error(err)
+		}
+		rcv.notifications = append(rcv.notifications, n)
+		rcv.received <- struct{}{}
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) wait(t *testing.T) WebhookNotification {
+	t.Helper()
+	select {
+	case <-rcv.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+	rcv.mux.Lock()
+	defer rcv.mux.Unlock()
+	return rcv.notifications[len(rcv.notifications)-1]
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	rcv := newWebhookReceiver(t, "s3cret", 2)
+	dispatcher, err := NewWebhookDispatcher(WebhookOptions{
+		Webhooks:   []Webhook{{URL: rcv.URL, Secret: "s3cret"}},
+		Debounce:   50 * time.Millisecond,
+		MinBackoff: 10 * time.Millisecond,
+		QueueDir:   t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	cfg := DefaultConfig()
+	cfg.Webhooks = dispatcher
+	ts := newTestServerWithConfig(t, cfg)
+
+	client := ts.dial(t, "room")
+	client.sendSyncUpdate(testUpdate([]testItem{{client: 1, root: "text", text: "abc"}}))
+	ts.ydb.AppendUpdate("room", testUpdate([]testItem{{client: 2, root: "text", text: "x"}}))
+
+	n := rcv.wait(t)
+	size, _ := ts.store.Size("room")
+	if n.Room != "room" || n.Offset != size || n.PreviousOffset != 0 || n.Bytes != size || n.Updates != 2 {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	if rcv.requests != 3 {
+		t.Fatalf("expected two failed attempts before the delivery, got %d requests", rcv.requests)
+	}
+
+	ts.ydb.AppendUpdate("room", testUpdate([]testItem{{client: 3, root: "text", text: "y"}}))
+	n = rcv.wait(t)
+	if n.PreviousOffset != size || n.Updates != 1 || len(n.Authors) != 0 {
+		t.Fatalf("unexpected second notification %+v", n)
+	}
+}
+
+func TestWebhookAuthors(t *testing.T) {
+	rcv := newWebhookReceiver(t, "", 0)
+	dispatcher, err := NewWebhookDispatcher(WebhookOptions{Webhooks: []Webhook{{URL: rcv.URL}}, Debounce: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	for _, principal := range []string{"bob", "alice", "bob"} {
+		dispatcher.update(UpdateEvent{Room: "room", Session: SessionInfo{Principal: principal}, Size: 10, Offset: 11})
+	}
+	if n := rcv.wait(t); len(n.Authors) != 2 || n.Authors[0] != "alice" || n.Authors[1] != "bob" {
+		t.Fatalf("unexpected authors %v", n.Authors)
+	}
+}
+
+func TestWebhookQueueSurvivesRestart(t *testing.T) {
+	queueDir := t.TempDir()
+	rcv := newWebhookReceiver(t, "k", 1<<30)
+	opts := WebhookOptions{
+		Webhooks:   []Webhook{{URL: rcv.URL, Secret: "k"}},
+		Debounce:   time.Hour,
+		MinBackoff: time.Hour,
+		QueueDir:   queueDir,
+		// The delivery waits for its retry, Close doesn't wait for it
+		CloseTimeout: 10 * time.Millisecond,
+	}
+	dispatcher, err := NewWebhookDispatcher(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.update(UpdateEvent{Room: "room", Size: 10, Offset: 11})
+	// Close doesn't wait for the debounce interval, the failing delivery stays queued
+	dispatcher.Close()
+	if entries, _ := os.ReadDir(queueDir); len(entries) != 1 {
+		t.Fatalf("expected one queued notification, got %d", len(entries))
+	}
+
+	rcv.mux.Lock()
+	rcv.failures = 0
+	rcv.mux.Unlock()
+	dispatcher, err = NewWebhookDispatcher(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	if n := rcv.wait(t); n.Room != "room" || n.Offset != 11 || n.Bytes != 11 {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for entries, _ := os.ReadDir(queueDir); len(entries) != 0; entries, _ = os.ReadDir(queueDir) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the delivered notification to leave the queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookCloseDelivers(t *testing.T) {
+	rcv := newWebhookReceiver(t, "", 0)
+	dispatcher, err := NewWebhookDispatcher(WebhookOptions{Webhooks: []Webhook{{URL: rcv.URL}}, Debounce: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.update(UpdateEvent{Room: "room", Size: 10, Offset: 11})
+	dispatcher.Close()
+	rcv.mux.Lock()
+	defer rcv.mux.Unlock()
+	if len(rcv.notifications) != 1 || dispatcher.FailedDeliveries() != 0 {
+		t.Fatalf("expected the pending notification to be delivered on close, got %d", len(rcv.notifications))
+	}
+}
@@ -2,8 +2,6 @@ package ydb
 
 import (
 	"bytes"
-	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -17,6 +15,19 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 )
 
+// Close codes sent to clients whose session was ended by the server.
+// For CloseRoomRenamed the close reason carries the new room name. CloseRoomReset
+// means the room content was replaced and clients must discard their local state.
+const (
+	CloseRoomDeleted = 4000
+	CloseRoomRenamed = 4001
+	CloseRateLimited = 4002
+	CloseRoomReset   = 4003
+)
+
+// maxCloseReasonLen is the longest reason that fits in a close control frame.
+const maxCloseReasonLen = 123
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -31,6 +42,8 @@ type wsConn struct {
 	send           chan *websocket.PreparedMessage
 	ydb            *Ydb
 	closeWritePump chan struct{}
+	limiter        *rateLimiter
+	heldUntil      time.Time // set by RateLimitDelay, only used by the read pump
 }
 
 func newWsConn(session *session, conn *websocket.Conn, ydb *Ydb) *wsConn {
@@ -38,7 +51,7 @@ func newWsConn(session *session, conn *websocket.Conn, ydb *Ydb) *wsConn {
 		conn:           conn,
 		session:        session,
 		ydb:            ydb,
-		send:           make(chan *websocket.PreparedMessage, ydb.cfg.SendBufferSize),
+		send:           make(chan *websocket.PreparedMessage, ydb.config().SendBufferSize),
 		closeWritePump: make(chan struct{}),
 	}
 }
@@ -47,25 +60,51 @@ func (wsConn *wsConn) WriteMessage(m []byte, pm *websocket.PreparedMessage) {
 	defer func() {
 		recover()
 	}()
-	debugMessageType("sending message to client..", m)
+	wsConn.ydb.debugMessageType("sending message to client", wsConn.session, m)
+	wsConn.ydb.metrics.messageOut(m)
 	wsConn.send <- pm
 }
 
+func (wsConn *wsConn) Close(code int, reason string) {
+	if len(reason) > maxCloseReasonLen {
+		reason = ""
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	wsConn.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	// Closing the socket ends readPump, which in turn stops writePump and removes the session
+	wsConn.conn.Close()
+}
+
 func (wsConn *wsConn) readPump() {
-	wsConn.conn.SetReadLimit(wsConn.ydb.cfg.MaxMessageSize)
 	wsConn.conn.SetReadDeadline(time.Now().Add(pongWait))
 	wsConn.conn.SetPongHandler(func(string) error {
 		wsConn.conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 	for {
+		maxMessageSize := wsConn.ydb.config().MaxMessageSize
+		wsConn.conn.SetReadLimit(maxMessageSize)
 		_, message, err := wsConn.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("ydb error: %v", err)
+				wsConn.ydb.log.Warn("unexpected websocket close",
+					"room", wsConn.session.roomname,
+					"session", wsConn.session.sessionid,
+					"remote", wsConn.session.remoteAddr,
+					"error", err)
 			}
 			break
 		}
+		// The limit may have been lowered by UpdateConfig while waiting for the message
+		if maxMessageSize = wsConn.ydb.config().MaxMessageSize; maxMessageSize > 0 && int64(len(message)) > maxMessageSize {
+			wsConn.Close(websocket.CloseMessageTooBig, "message too big")
+			break
+		}
+		wsConn.ydb.metrics.messageIn(message)
+		wsConn.ydb.debugMessageType("received message from client", wsConn.session, message)
+		if !wsConn.admitMessage(len(message)) {
+			continue
+		}
 		mbuffer := bytes.NewBuffer(message)
 		for {
 			err := wsConn.ydb.readMessage(mbuffer, wsConn.session)
@@ -76,15 +115,16 @@ func (wsConn *wsConn) readPump() {
 	}
 	close(wsConn.closeWritePump)
 	wsConn.conn.Close()
-	debug("ending read pump for ws conn")
+	wsConn.ydb.log.Debug("read pump ended", "room", wsConn.session.roomname, "session", wsConn.session.sessionid)
 }
 
 func (wsConn *wsConn) writePump() {
 	conn := wsConn.conn
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
-		debug("ending write pump for ws conn")
+		wsConn.ydb.log.Debug("write pump ended", "room", wsConn.session.roomname, "session", wsConn.session.sessionid)
 		ticker.Stop()
+		wsConn.ydb.conns.Delete(wsConn)
 		wsConn.session.removeConn(wsConn.ydb)
 		close(wsConn.send)
 		conn.Close()
@@ -101,7 +141,11 @@ func (wsConn *wsConn) writePump() {
 			}
 			err := conn.WritePreparedMessage(message)
 			if err != nil {
-				fmt.Println("server error when writing prepared message to conn", err)
+				wsConn.ydb.log.Warn("failed to write message",
+					"room", wsConn.session.roomname,
+					"session", wsConn.session.sessionid,
+					"remote", wsConn.session.remoteAddr,
+					"error", err)
 				return
 			}
 		case <-ticker.C:
@@ -113,39 +157,82 @@ func (wsConn *wsConn) writePump() {
 	}
 }
 
+// YdbWsConnectionHandler is NewWsHandler with the default room resolution.
 func YdbWsConnectionHandler(ydbInstance *Ydb) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("new client..")
-
-		roomnameInterface := r.Context().Value("roomname")
-
-		urlParts := strings.Split(r.URL.Path, "/")
-		roomname := urlParts[len(urlParts)-1]
-
-		if roomnameInterface != nil {
-			roomname = roomnameInterface.(string)
-		}
-
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			fmt.Printf("error: error upgrading client %s", err.Error())
-			return
-		}
+	return NewWsHandler(ydbInstance).ServeHTTP
+}
 
-		session := ydbInstance.createSessionWithAccess(roomname, isReadOnlySession(r.Context()))
-		wsConn := newWsConn(session, conn, ydbInstance)
-		session.setConn(wsConn)
+// serveWs upgrades the request and joins the session to room. Subdocuments
+// opened over the session are mapped to rooms by subdocRoom, if not nil.
+func (ydbInstance *Ydb) serveWs(w http.ResponseWriter, r *http.Request, room YjsRoomName, subdocRoom SubdocResolver) {
+	roomname := string(room)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		ydbInstance.log.Warn("failed to upgrade connection", "room", roomname, "remote", r.RemoteAddr, "error", err)
+		return
+	}
 
-		go ydbInstance.subscribeRoom(session, 0)
+	session := ydbInstance.createSessionWithAccess(roomname, isReadOnlySession(r.Context()))
+	session.principal = principalFromContext(r.Context())
+	if session.principal == "" {
+		session.principal = clientCertPrincipal(r)
+	}
+	session.remoteAddr = r.RemoteAddr
+	session.subdocRoom = subdocRoom
+	wsConn := newWsConn(session, conn, ydbInstance)
+	session.setConn(wsConn)
+	ydbInstance.conns.Store(wsConn, struct{}{})
+	ydbInstance.log.Debug("client connected",
+		"room", session.roomname,
+		"session", session.sessionid,
+		"remote", session.remoteAddr,
+		"principal", session.principal,
+		"readonly", session.readOnly)
+
+	go ydbInstance.subscribeRoom(session, 0)
+
+	go wsConn.readPump()
+	go wsConn.writePump()
+}
 
-		go wsConn.readPump()
-		go wsConn.writePump()
+// newServeMux routes the endpoints of `ydb start` below prefix.
+func newServeMux(sc *startConfig, ydbInstance *Ydb) *http.ServeMux {
+	prefix := "/" + strings.Trim(sc.PathPrefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	mux := http.NewServeMux()
+	ws := NewWsHandler(ydbInstance, WithRoomPathPrefix(prefix+"/ws/"))
+	mux.Handle(prefix+"/ws", ws)
+	mux.Handle(prefix+"/ws/", ws)
+	if sc.Rest {
+		mux.Handle(prefix+"/rooms/", NewRestHandler(ydbInstance, WithRoomPathPrefix(prefix+"/rooms/")))
+	}
+	if sc.Events {
+		mux.Handle(prefix+"/events/", NewSSEHandler(ydbInstance, WithRoomPathPrefix(prefix+"/events/")))
+	}
+	if sc.Metrics {
+		mux.Handle(prefix+"/metrics", ydbInstance.MetricsHandler())
+		mux.Handle(prefix+"/stats", ydbInstance.StatsHandler())
 	}
+	if sc.Admin {
+		mux.Handle(prefix+"/admin/", http.StripPrefix(prefix+"/admin", ydbInstance.AdminHandler()))
+	}
+	return mux
 }
 
-func setupWebsocketsListener(addr string, ydbInstance *Ydb) {
-	http.HandleFunc("/ws", YdbWsConnectionHandler(ydbInstance))
-	err := http.ListenAndServe(addr, nil)
+func setupWebsocketsListener(sc *startConfig, ydbInstance *Ydb, reloader *tlsReloader) {
+	server := &http.Server{
+		Addr:    sc.Addr,
+		Handler: newServeMux(sc, ydbInstance),
+	}
+	var err error
+	if reloader != nil {
+		server.TLSConfig = reloader.serverConfig()
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		exitBecause(err.Error())
 	}
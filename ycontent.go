@@ -0,0 +1,276 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Content refs as encoded in the low 5 bits of a struct's info byte.
+const (
+	yRefGC      = 0
+	yRefDeleted = 1
+	yRefJSON    = 2
+	yRefBinary  = 3
+	yRefString  = 4
+	yRefEmbed   = 5
+	yRefFormat  = 6
+	yRefType    = 7
+	yRefAny     = 8
+	yRefDoc     = 9
+	yRefSkip    = 10
+)
+
+// Type refs of ContentType.
+const (
+	yArrayRef       = 0
+	yMapRef         = 1
+	yTextRef        = 2
+	yXmlElementRef  = 3
+	yXmlFragmentRef = 4
+	yXmlHookRef     = 5
+	yXmlTextRef     = 6
+	// yUnknownRef marks a root type whose kind is not known yet
+	yUnknownRef = -1
+)
+
+// yContent is the payload of an item.
+type yContent interface {
+	ref() byte
+	len() uint64
+	countable() bool
+	// splice truncates the content to offset and returns the remainder
+	splice(offset uint64) yContent
+	// write encodes the content, skipping the first offset units
+	write(buf *bytes.Buffer, offset uint64)
+}
+
+type contentDeleted struct {
+	n uint64
+}
+
+func (c *contentDeleted) ref() byte       { return yRefDeleted }
+func (c *contentDeleted) len() uint64     { return c.n }
+func (c *contentDeleted) countable() bool { return false }
+
+func (c *contentDeleted) splice(offset uint64) yContent {
+	right := &contentDeleted{n: c.n - offset}
+	c.n = offset
+	return right
+}
+
+func (c *contentDeleted) write(buf *bytes.Buffer, offset uint64) {
+	writeUvarint(buf, c.n-offset)
+}
+
+// contentJSON holds values encoded as JSON strings (legacy Y.Array content).
+type contentJSON struct {
+	values []string
+}
+
+func (c *contentJSON) ref() byte       { return yRefJSON }
+func (c *contentJSON) len() uint64     { return uint64(len(c.values)) }
+func (c *contentJSON) countable() bool { return true }
+
+func (c *contentJSON) splice(offset uint64) yContent {
+	right := &contentJSON{values: append([]string(nil), c.values[offset:]...)}
+	c.values = c.values[:offset]
+	return right
+}
+
+func (c *contentJSON) write(buf *bytes.Buffer, offset uint64) {
+	writeUvarint(buf, uint64(len(c.values))-offset)
+	for _, v := range c.values[offset:] {
+		writeVarString(buf, v)
+	}
+}
+
+type contentBinary struct {
+	data []byte
+}
+
+func (c *contentBinary) ref() byte                         { return yRefBinary }
+func (c *contentBinary) len() uint64                       { return 1 }
+func (c *contentBinary) countable() bool                   { return true }
+func (c *contentBinary) splice(offset uint64) yContent     { panic("ydb: binary content can't be split") }
+func (c *contentBinary) write(buf *bytes.Buffer, _ uint64) { writeVarBytes(buf, c.data) }
+
+type contentString struct {
+	units []uint16
+}
+
+func (c *contentString) ref() byte       { return yRefString }
+func (c *contentString) len() uint64     { return uint64(len(c.units)) }
+func (c *contentString) countable() bool { return true }
+
+func (c *contentString) splice(offset uint64) yContent {
+	right := &contentString{units: append([]uint16(nil), c.units[offset:]...)}
+	c.units = c.units[:offset:offset]
+	// Splitting a surrogate pair leaves two replacement characters, like Yjs does
+	if last := c.units[offset-1]; last >= 0xD800 && last <= 0xDBFF {
+		c.units[offset-1] = 0xFFFD
+		right.units[0] = 0xFFFD
+	}
+	return right
+}
+
+func (c *contentString) write(buf *bytes.Buffer, offset uint64) {
+	writeVarString(buf, fromUTF16(c.units[offset:]))
+}
+
+// contentEmbed is an embedded object in Y.Text, kept as its JSON encoding.
+type contentEmbed struct {
+	json string
+}
+
+func (c *contentEmbed) ref() byte                         { return yRefEmbed }
+func (c *contentEmbed) len() uint64                       { return 1 }
+func (c *contentEmbed) countable() bool                   { return true }
+func (c *contentEmbed) splice(offset uint64) yContent     { panic("ydb: embed content can't be split") }
+func (c *contentEmbed) write(buf *bytes.Buffer, _ uint64) { writeVarString(buf, c.json) }
+
+// contentFormat is a Y.Text formatting attribute; value is JSON encoded.
+type contentFormat struct {
+	key   string
+	value string
+}
+
+func (c *contentFormat) ref() byte                     { return yRefFormat }
+func (c *contentFormat) len() uint64                   { return 1 }
+func (c *contentFormat) countable() bool               { return false }
+func (c *contentFormat) splice(offset uint64) yContent { panic("ydb: format content can't be split") }
+
+func (c *contentFormat) write(buf *bytes.Buffer, _ uint64) {
+	writeVarString(buf, c.key)
+	writeVarString(buf, c.value)
+}
+
+// contentType holds a nested shared type.
+type contentType struct {
+	typ *yType
+}
+
+func (c *contentType) ref() byte                     { return yRefType }
+func (c *contentType) len() uint64                   { return 1 }
+func (c *contentType) countable() bool               { return true }
+func (c *contentType) splice(offset uint64) yContent { panic("ydb: type content can't be split") }
+
+func (c *contentType) write(buf *bytes.Buffer, _ uint64) {
+	writeUvarint(buf, uint64(c.typ.ref))
+	if c.typ.ref == yXmlElementRef || c.typ.ref == yXmlHookRef {
+		writeVarString(buf, c.typ.name)
+	}
+}
+
+type contentAny struct {
+	values []any
+}
+
+func (c *contentAny) ref() byte       { return yRefAny }
+func (c *contentAny) len() uint64     { return uint64(len(c.values)) }
+func (c *contentAny) countable() bool { return true }
+
+func (c *contentAny) splice(offset uint64) yContent {
+	right := &contentAny{values: append([]any(nil), c.values[offset:]...)}
+	c.values = c.values[:offset:offset]
+	return right
+}
+
+func (c *contentAny) write(buf *bytes.Buffer, offset uint64) {
+	writeUvarint(buf, uint64(len(c.values))-offset)
+	for _, v := range c.values[offset:] {
+		writeAny(buf, v)
+	}
+}
+
+// contentDoc references a subdocument by its guid.
+type contentDoc struct {
+	guid string
+	opts any
+}
+
+func (c *contentDoc) ref() byte                     { return yRefDoc }
+func (c *contentDoc) len() uint64                   { return 1 }
+func (c *contentDoc) countable() bool               { return true }
+func (c *contentDoc) splice(offset uint64) yContent { panic("ydb: doc content can't be split") }
+
+func (c *contentDoc) write(buf *bytes.Buffer, _ uint64) {
+	writeVarString(buf, c.guid)
+	writeAny(buf, c.opts)
+}
+
+func readContent(d *yDecoder, ref byte) (yContent, error) {
+	switch ref {
+	case yRefDeleted:
+		n, err := d.readVarUint()
+		return &contentDeleted{n: n}, err
+	case yRefJSON:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(d.remaining()) {
+			return nil, errUnexpectedEOF
+		}
+		values := make([]string, n)
+		for i := range values {
+			if values[i], err = d.readVarString(); err != nil {
+				return nil, err
+			}
+		}
+		return &contentJSON{values: values}, nil
+	case yRefBinary:
+		bs, err := d.readVarBytes()
+		return &contentBinary{data: append([]byte(nil), bs...)}, err
+	case yRefString:
+		s, err := d.readVarString()
+		return &contentString{units: toUTF16(s)}, err
+	case yRefEmbed:
+		s, err := d.readVarString()
+		return &contentEmbed{json: s}, err
+	case yRefFormat:
+		key, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readVarString()
+		return &contentFormat{key: key, value: value}, err
+	case yRefType:
+		typeRef, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if typeRef > yXmlTextRef {
+			return nil, errors.New("unknown type ref in Yjs update")
+		}
+		t := &yType{ref: int(typeRef)}
+		if typeRef == yXmlElementRef || typeRef == yXmlHookRef {
+			if t.name, err = d.readVarString(); err != nil {
+				return nil, err
+			}
+		}
+		return &contentType{typ: t}, nil
+	case yRefAny:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(d.remaining()) {
+			return nil, errUnexpectedEOF
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = d.readAny(); err != nil {
+				return nil, err
+			}
+		}
+		return &contentAny{values: values}, nil
+	case yRefDoc:
+		guid, err := d.readVarString()
+		if err != nil {
+			return nil, err
+		}
+		opts, err := d.readAny()
+		return &contentDoc{guid: guid, opts: opts}, err
+	}
+	return nil, errors.New("unknown content ref in Yjs update")
+}
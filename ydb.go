@@ -1,6 +1,8 @@
 package ydb
 
 import (
+	"errors"
+	"log/slog"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -13,12 +15,27 @@ type Ydb struct {
 	rooms       map[YjsRoomName]*room
 	sessionsMux sync.Mutex
 	sessions    map[uint64]*session
+	streamsMux  sync.Mutex
+	streams     map[uint64]*eventStream // SSE streams, ended by evictRoom
 	seed        *rand.Rand
 	seedMux     sync.Mutex
 	store       Store
 	broadcaster Broadcaster
-	cfg         Config
+	cfg         atomic.Pointer[Config] // replaced as a whole by UpdateConfig
+	cfgMux      sync.Mutex             // serializes UpdateConfig
+	reapReset   chan struct{}
+	events      *eventQueue
+	log         *slog.Logger
+	logLevel    slog.LevelVar
 	done        chan struct{}
+	started     time.Time
+
+	metrics       *metrics
+	conns         sync.Map // *wsConn -> struct{}, for send queue metrics
+	rateLimits    rateLimitCounters
+	ipLimitersMux sync.Mutex
+	ipLimiters    map[string]*rateLimiter
+	writeLocks    [writeLockStripes]sync.Mutex // by hash of the room name, order appends and their audit records
 }
 
 func (ydb *Ydb) genUint32() uint32 {
@@ -35,6 +52,19 @@ func (ydb *Ydb) genUint64() uint64 {
 	return n
 }
 
+// NewYdb is like InitYdb but validates its arguments first; see Config.Validate.
+func NewYdb(store Store, broadcaster Broadcaster, cfg Config) (*Ydb, error) {
+	if store == nil || broadcaster == nil {
+		return nil, errors.New("ydb: store and broadcaster are required")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return InitYdb(store, broadcaster, cfg), nil
+}
+
+// InitYdb creates an instance without validating cfg (DefaultConfig if
+// omitted). Prefer NewYdb, which reports invalid configurations as errors.
 func InitYdb(store Store, broadcaster Broadcaster, cfgs ...Config) *Ydb {
 	cfg := DefaultConfig()
 	if len(cfgs) > 0 {
@@ -43,11 +73,21 @@ func InitYdb(store Store, broadcaster Broadcaster, cfgs ...Config) *Ydb {
 	ydb := &Ydb{
 		rooms:       make(map[YjsRoomName]*room, 1000),
 		sessions:    make(map[uint64]*session),
+		streams:     make(map[uint64]*eventStream),
 		seed:        rand.New(rand.NewSource(time.Now().UnixNano())),
 		store:       store,
 		broadcaster: broadcaster,
-		cfg:         cfg,
+		reapReset:   make(chan struct{}, 1),
 		done:        make(chan struct{}),
+		started:     time.Now(),
+		ipLimiters:  make(map[string]*rateLimiter),
+		metrics:     newMetrics(),
+	}
+	ydb.cfg.Store(&cfg)
+	ydb.log = newLogger(cfg.Logger, &ydb.logLevel)
+	if cfg.EventHandler != nil {
+		ydb.events = newEventQueue(cfg.EventHandler, cfg.EventQueueSize, ydb.log)
+		go ydb.events.run(ydb.done)
 	}
 	go ydb.roomReaper()
 	return ydb
@@ -73,6 +113,7 @@ func (ydb *Ydb) getOrCreateRoom(name YjsRoomName) *room {
 			r.mux.Lock()
 			r.offset = size
 			r.mux.Unlock()
+			ydb.emitRoomEvent(name, EventHandler.OnRoomLoaded)
 		} else {
 			ydb.roomsMux.Unlock()
 		}
@@ -109,26 +150,31 @@ func (ydb *Ydb) removeSession(sessionid uint64) {
 }
 
 func (ydb *Ydb) roomReaper() {
-	ticker := time.NewTicker(ydb.cfg.RoomReapInterval)
+	ticker := time.NewTicker(ydb.config().RoomReapInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ydb.done:
 			return
+		case <-ydb.reapReset:
+			ticker.Reset(ydb.config().RoomReapInterval)
 		case <-ticker.C:
 			ydb.reapIdleRooms()
+			ydb.reapIPRateLimiters()
 		}
 	}
 }
 
 func (ydb *Ydb) reapIdleRooms() {
+	atomic.AddUint64(&ydb.metrics.reaperRuns, 1)
 	now := time.Now()
+	idleTimeout := ydb.config().RoomIdleTimeout
 	ydb.roomsMux.RLock()
 	var toRemove []YjsRoomName
 	for name, r := range ydb.rooms {
 		if atomic.LoadInt32(&r.subCount) == 0 {
 			r.mux.Lock()
-			idle := now.Sub(r.lastActive) > ydb.cfg.RoomIdleTimeout
+			idle := now.Sub(r.lastActive) > idleTimeout
 			r.mux.Unlock()
 			if idle {
 				toRemove = append(toRemove, name)
@@ -143,8 +189,23 @@ func (ydb *Ydb) reapIdleRooms() {
 			r := ydb.rooms[name]
 			if r != nil && atomic.LoadInt32(&r.subCount) == 0 {
 				delete(ydb.rooms, name)
+				atomic.AddUint64(&ydb.metrics.roomsReaped, 1)
+				ydb.emitRoomEvent(name, EventHandler.OnRoomReaped)
 			}
 		}
 		ydb.roomsMux.Unlock()
 	}
 }
+
+// roomSessions returns the sessions currently bound to a room.
+func (ydb *Ydb) roomSessions(name YjsRoomName) []*session {
+	ydb.sessionsMux.Lock()
+	defer ydb.sessionsMux.Unlock()
+	var sessions []*session
+	for _, s := range ydb.sessions {
+		if s.roomname == name {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
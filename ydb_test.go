@@ -2,6 +2,7 @@ package ydb
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -344,3 +345,150 @@ func TestSubscribeRoomCatchup(t *testing.T) {
 		t.Fatalf("catch-up message mismatch: got %v, want %v", msgs[0], msgBuf.Bytes())
 	}
 }
+
+func TestDeleteRoomClosesSessionsAndUnsubscribes(t *testing.T) {
+	store := newMemoryStore()
+	broadcaster := NewLocalBroadcaster(64)
+	ydbInstance := InitYdb(store, broadcaster, DefaultConfig())
+	defer ydbInstance.Close()
+
+	roomname := YjsRoomName("delete-me")
+	s := ydbInstance.createSession(string(roomname))
+	mc := &mockConn{}
+	s.setConn(mc)
+	ydbInstance.subscribeRoom(s, 0)
+	ydbInstance.updateRoom(roomname, s, makeYjsSyncUpdate([]byte("data")))
+
+	other := ydbInstance.createSession("other-room")
+	otherConn := &mockConn{}
+	other.setConn(otherConn)
+
+	if err := ydbInstance.DeleteRoom(roomname); err != nil {
+		t.Fatalf("DeleteRoom failed: %v", err)
+	}
+
+	code, _, calls := mc.getClose()
+	if calls != 1 || code != CloseRoomDeleted {
+		t.Fatalf("expected one close with code %d, got %d calls with code %d", CloseRoomDeleted, calls, code)
+	}
+	if _, _, calls := otherConn.getClose(); calls != 0 {
+		t.Fatalf("session of another room should not be closed")
+	}
+
+	lb := broadcaster.(*LocalBroadcaster)
+	lb.mu.RLock()
+	_, subscribed := lb.rooms[roomname]
+	lb.mu.RUnlock()
+	if subscribed {
+		t.Fatalf("broadcaster subscriptions should be cleared")
+	}
+
+	ydbInstance.roomsMux.RLock()
+	_, exists := ydbInstance.rooms[roomname]
+	ydbInstance.roomsMux.RUnlock()
+	if exists {
+		t.Fatalf("room should be forgotten after delete")
+	}
+
+	if size, _ := store.Size(roomname); size != 0 {
+		t.Fatalf("expected store data removed, size=%d", size)
+	}
+}
+
+func TestRenameRoomRejectsExistingTarget(t *testing.T) {
+	store := newMemoryStore()
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("src")
+	mc := &mockConn{}
+	s.setConn(mc)
+	ydbInstance.updateRoom("src", s, makeYjsSyncUpdate([]byte("a")))
+	ydbInstance.updateRoom("dst", s, makeYjsSyncUpdate([]byte("b")))
+
+	if err := ydbInstance.RenameRoom("src", "dst"); !errors.Is(err, ErrRoomExists) {
+		t.Fatalf("expected ErrRoomExists, got %v", err)
+	}
+	if _, _, calls := mc.getClose(); calls != 0 {
+		t.Fatalf("sessions should not be dropped when rename is refused")
+	}
+}
+
+func TestDeleteAndRenameWaitForWrites(t *testing.T) {
+	store := newMemoryStore()
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+	ydbInstance.updateRoom("a", nil, makeYjsSyncUpdate([]byte("a")))
+	ydbInstance.updateRoom("b", nil, makeYjsSyncUpdate([]byte("b")))
+
+	// Stand in for a write in progress
+	writeLock := ydbInstance.writeLock("a")
+	writeLock.Lock()
+	deleted := make(chan error)
+	go func() { deleted <- ydbInstance.DeleteRoom("a") }()
+	select {
+	case err := <-deleted:
+		t.Fatalf("delete didn't wait for the write lock: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	writeLock.Unlock()
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+
+	// Find a name on the same stripe, which must not be locked twice
+	to := YjsRoomName("c")
+	for i := 0; writeLockIndex(to) != writeLockIndex("b"); i++ {
+		to = YjsRoomName("c" + strconv.Itoa(i))
+	}
+	if err := ydbInstance.RenameRoom("b", to); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := store.Size(to); size == 0 {
+		t.Fatalf("expected the renamed room under %s", to)
+	}
+}
+
+type storeWithoutRoomManager struct {
+	Store
+}
+
+func TestDeleteRoomRequiresRoomManager(t *testing.T) {
+	ydbInstance := InitYdb(storeWithoutRoomManager{newMemoryStore()}, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+
+	if err := ydbInstance.DeleteRoom("any"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+	if err := ydbInstance.RenameRoom("a", "b"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestRoomsReportsActiveRooms(t *testing.T) {
+	store := newMemoryStore()
+	ydbInstance := InitYdb(store, NewLocalBroadcaster(64), DefaultConfig())
+	defer ydbInstance.Close()
+
+	s := ydbInstance.createSession("busy")
+	s.setConn(&mockConn{})
+	ydbInstance.subscribeRoom(s, 0)
+	ydbInstance.updateRoom("busy", s, makeYjsSyncUpdate([]byte("data")))
+	ydbInstance.getOrCreateRoom("quiet")
+
+	rooms := ydbInstance.Rooms()
+	if len(rooms) != 2 || rooms[0].Name != "busy" || rooms[1].Name != "quiet" {
+		t.Fatalf("unexpected rooms: %+v", rooms)
+	}
+	size, _ := store.Size("busy")
+	if rooms[0].Subscribers != 1 || rooms[0].Offset != size || rooms[0].LastActive.IsZero() {
+		t.Fatalf("unexpected busy room info: %+v (store size %d)", rooms[0], size)
+	}
+	if rooms[1].Subscribers != 0 || rooms[1].Offset != 0 {
+		t.Fatalf("unexpected quiet room info: %+v", rooms[1])
+	}
+
+	if _, _, err := ydbInstance.ListRooms("", "", 0); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported for store without RoomLister, got %v", err)
+	}
+}
@@ -0,0 +1,887 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// yID identifies a struct by the client that created it and a logical clock.
+type yID struct {
+	client uint64
+	clock  uint64
+}
+
+// yItem is a Yjs struct: either an item with content or, if gc is set, a
+// garbage collected range of which only the id and length are known.
+type yItem struct {
+	id          yID
+	length      uint64
+	gc          bool
+	origin      *yID
+	rightOrigin *yID
+	left, right *yItem
+	parent      *yType
+	// unresolved parent reference as decoded from an update
+	parentRoot *string
+	parentID   *yID
+	parentSub  *string
+	content    yContent
+	deleted    bool
+}
+
+func (item *yItem) lastID() yID {
+	return yID{client: item.id.client, clock: item.id.clock + item.length - 1}
+}
+
+func (item *yItem) countable() bool {
+	return !item.gc && item.content.countable()
+}
+
+// yType is a shared type (Y.Array, Y.Map, Y.Text, Y.Xml*). Root types are
+// created on first reference and have no item.
+type yType struct {
+	doc    *Doc
+	item   *yItem
+	ref    int
+	name   string // root key, or node name of an XML element
+	start  *yItem
+	keys   map[string]*yItem // map entries, pointing at the current (rightmost) item
+	length uint64
+}
+
+func (t *yType) mapItems() map[string]*yItem {
+	if t.keys == nil {
+		t.keys = make(map[string]*yItem)
+	}
+	return t.keys
+}
+
+type yDeleteRange struct {
+	client uint64
+	clock  uint64
+	len    uint64
+}
+
+// Doc is an in-memory Yjs document. It can apply and produce binary updates
+// in the Yjs v1 update format.
+type Doc struct {
+	clientID  uint64
+	structs   map[uint64][]*yItem
+	share     map[string]*yType
+	pending   []*yItem
+	pendingDs []yDeleteRange
+	// deletes made by local edits during Transact
+	txn *[]yDeleteRange
+}
+
+// NewDoc creates an empty document.
+func NewDoc() *Doc {
+	return &Doc{
+		structs: make(map[uint64][]*yItem),
+		share:   make(map[string]*yType),
+	}
+}
+
+func (d *Doc) root(name string) *yType {
+	t := d.share[name]
+	if t == nil {
+		t = &yType{doc: d, ref: yUnknownRef, name: name}
+		d.share[name] = t
+	}
+	return t
+}
+
+// state returns the next expected clock of a client.
+func (d *Doc) state(client uint64) uint64 {
+	structs := d.structs[client]
+	if len(structs) == 0 {
+		return 0
+	}
+	last := structs[len(structs)-1]
+	return last.id.clock + last.length
+}
+
+// stateVector returns the next expected clock of every known client.
+func (d *Doc) stateVector() map[uint64]uint64 {
+	sv := make(map[uint64]uint64, len(d.structs))
+	for client := range d.structs {
+		sv[client] = d.state(client)
+	}
+	return sv
+}
+
+func findStructIndex(structs []*yItem, clock uint64) int {
+	return sort.Search(len(structs), func(i int) bool {
+		s := structs[i]
+		return s.id.clock+s.length > clock
+	})
+}
+
+func (d *Doc) find(id yID) *yItem {
+	structs := d.structs[id.client]
+	i := findStructIndex(structs, id.clock)
+	if i == len(structs) || structs[i].id.clock > id.clock {
+		return nil
+	}
+	return structs[i]
+}
+
+// itemCleanStart returns the struct that starts at id, splitting if
+// necessary, or nil if id is unknown.
+func (d *Doc) itemCleanStart(id yID) *yItem {
+	structs := d.structs[id.client]
+	i := findStructIndex(structs, id.clock)
+	if i == len(structs) {
+		return nil
+	}
+	item := structs[i]
+	if item.id.clock < id.clock && !item.gc {
+		right := d.splitItem(item, id.clock-item.id.clock)
+		d.insertStruct(id.client, i+1, right)
+		return right
+	}
+	return item
+}
+
+// itemCleanEnd returns the struct that ends at id, splitting if necessary,
+// or nil if id is unknown.
+func (d *Doc) itemCleanEnd(id yID) *yItem {
+	structs := d.structs[id.client]
+	i := findStructIndex(structs, id.clock)
+	if i == len(structs) {
+		return nil
+	}
+	item := structs[i]
+	if id.clock != item.id.clock+item.length-1 && !item.gc {
+		d.insertStruct(id.client, i+1, d.splitItem(item, id.clock-item.id.clock+1))
+	}
+	return item
+}
+
+func (d *Doc) insertStruct(client uint64, i int, item *yItem) {
+	structs := d.structs[client]
+	structs = append(structs, nil)
+	copy(structs[i+1:], structs[i:])
+	structs[i] = item
+	d.structs[client] = structs
+}
+
+func (d *Doc) splitItem(left *yItem, diff uint64) *yItem {
+	client, clock := left.id.client, left.id.clock
+	right := &yItem{
+		id:          yID{client: client, clock: clock + diff},
+		length:      left.length - diff,
+		origin:      &yID{client: client, clock: clock + diff - 1},
+		rightOrigin: left.rightOrigin,
+		left:        left,
+		right:       left.right,
+		parent:      left.parent,
+		parentSub:   left.parentSub,
+		content:     left.content.splice(diff),
+		deleted:     left.deleted,
+	}
+	left.right = right
+	if right.right != nil {
+		right.right.left = right
+	}
+	if right.parentSub != nil && right.right == nil && right.parent != nil {
+		right.parent.mapItems()[*right.parentSub] = right
+	}
+	left.length = diff
+	return right
+}
+
+// ApplyUpdate integrates a Yjs v1 update. Structs whose dependencies are not
+// known yet are kept and integrated once a later update provides them.
+func (d *Doc) ApplyUpdate(update []byte) error {
+	structs, ds, err := decodeUpdate(update)
+	if err != nil {
+		return err
+	}
+	d.pending = append(d.pending, structs...)
+	d.pendingDs = append(d.pendingDs, ds...)
+	d.integratePending()
+	d.applyPendingDeletes()
+	return nil
+}
+
+func (d *Doc) integratePending() {
+	// Structs of one client are integrated in clock order
+	sort.SliceStable(d.pending, func(i, j int) bool {
+		a, b := d.pending[i].id, d.pending[j].id
+		if a.client != b.client {
+			return a.client > b.client
+		}
+		return a.clock < b.clock
+	})
+	for progress := true; progress; {
+		progress = false
+		rest := d.pending[:0]
+		for _, item := range d.pending {
+			state := d.state(item.id.client)
+			switch {
+			case item.id.clock+item.length <= state:
+				// already integrated
+				progress = true
+			case item.id.clock > state || !d.hasDependencies(item):
+				rest = append(rest, item)
+			default:
+				d.integrate(item, state-item.id.clock)
+				progress = true
+			}
+		}
+		for i := len(rest); i < len(d.pending); i++ {
+			d.pending[i] = nil
+		}
+		d.pending = rest
+	}
+}
+
+// hasDependencies reports whether the origins and parent of an item are known.
+// Unlike Yjs, references to the item's own client are checked as well: a
+// malformed update can point at clocks that don't exist yet.
+func (d *Doc) hasDependencies(item *yItem) bool {
+	for _, dep := range []*yID{item.origin, item.rightOrigin, item.parentID} {
+		if dep != nil && dep.clock >= d.state(dep.client) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Doc) integrate(item *yItem, offset uint64) {
+	if item.gc {
+		item.id.clock += offset
+		item.length -= offset
+		d.structs[item.id.client] = append(d.structs[item.id.client], item)
+		return
+	}
+
+	// Resolve references, like Item.getMissing in Yjs. hasDependencies
+	// checked that they are known; an unresolved one still only turns the
+	// item into a GC struct below.
+	unresolved := false
+	if item.origin != nil {
+		if item.left = d.itemCleanEnd(*item.origin); item.left != nil {
+			last := item.left.lastID()
+			item.origin = &last
+		} else {
+			unresolved = true
+		}
+	}
+	if item.rightOrigin != nil {
+		if item.right = d.itemCleanStart(*item.rightOrigin); item.right != nil {
+			id := item.right.id
+			item.rightOrigin = &id
+		} else {
+			unresolved = true
+		}
+	}
+	switch {
+	case unresolved:
+		item.parent = nil
+	case (item.left != nil && item.left.gc) || (item.right != nil && item.right.gc):
+		item.parent = nil
+	case item.parentRoot != nil:
+		item.parent = d.root(*item.parentRoot)
+	case item.parentID != nil:
+		parentItem := d.find(*item.parentID)
+		if parentItem == nil {
+			break
+		}
+		if ct, ok := parentItem.content.(*contentType); ok && !parentItem.gc {
+			item.parent = ct.typ
+		}
+	case item.left != nil:
+		item.parent, item.parentSub = item.left.parent, item.left.parentSub
+	case item.right != nil:
+		item.parent, item.parentSub = item.right.parent, item.right.parentSub
+	}
+
+	if offset > 0 {
+		item.id.clock += offset
+		item.content = item.content.splice(offset)
+		item.length -= offset
+		if item.left = d.itemCleanEnd(yID{client: item.id.client, clock: item.id.clock - 1}); item.left != nil {
+			last := item.left.lastID()
+			item.origin = &last
+		} else {
+			item.parent = nil
+		}
+	}
+
+	if item.parent == nil {
+		// The parent was garbage collected; keep the range as a GC struct
+		gc := &yItem{id: item.id, length: item.length, gc: true}
+		d.structs[gc.id.client] = append(d.structs[gc.id.client], gc)
+		return
+	}
+	d.integrateItem(item)
+}
+
+// integrateItem places an item into its parent using the YATA conflict
+// resolution of Item.integrate in Yjs.
+func (d *Doc) integrateItem(item *yItem) {
+	parent := item.parent
+	if (item.left == nil && (item.right == nil || item.right.left != nil)) || (item.left != nil && item.left.right != item.right) {
+		left := item.left
+		var o *yItem
+		switch {
+		case left != nil:
+			o = left.right
+		case item.parentSub != nil:
+			o = parent.mapItems()[*item.parentSub]
+			for o != nil && o.left != nil {
+				o = o.left
+			}
+		default:
+			o = parent.start
+		}
+		conflicting := make(map[*yItem]struct{})
+		beforeOrigin := make(map[*yItem]struct{})
+		for o != nil && o != item.right {
+			beforeOrigin[o] = struct{}{}
+			conflicting[o] = struct{}{}
+			if sameID(item.origin, o.origin) {
+				if o.id.client < item.id.client {
+					left = o
+					clear(conflicting)
+				} else if sameID(item.rightOrigin, o.rightOrigin) {
+					break
+				}
+			} else if o.origin != nil && inSet(beforeOrigin, d.find(*o.origin)) {
+				if !inSet(conflicting, d.find(*o.origin)) {
+					left = o
+					clear(conflicting)
+				}
+			} else {
+				break
+			}
+			o = o.right
+		}
+		item.left = left
+	}
+
+	if item.left != nil {
+		item.right = item.left.right
+		item.left.right = item
+	} else {
+		var r *yItem
+		if item.parentSub != nil {
+			r = parent.mapItems()[*item.parentSub]
+			for r != nil && r.left != nil {
+				r = r.left
+			}
+		} else {
+			r = parent.start
+			parent.start = item
+		}
+		item.right = r
+	}
+	if item.right != nil {
+		item.right.left = item
+	} else if item.parentSub != nil {
+		// item is the current value of the map key, the previous one is overwritten
+		parent.mapItems()[*item.parentSub] = item
+		if item.left != nil {
+			d.deleteItem(item.left)
+		}
+	}
+	if item.parentSub == nil && item.countable() && !item.deleted {
+		parent.length += item.length
+	}
+	d.structs[item.id.client] = append(d.structs[item.id.client], item)
+	if ct, ok := item.content.(*contentType); ok {
+		ct.typ.doc = d
+		ct.typ.item = item
+	}
+	if (parent.item != nil && parent.item.deleted) || (item.parentSub != nil && item.right != nil) {
+		d.deleteItem(item)
+	}
+}
+
+func sameID(a, b *yID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func inSet(set map[*yItem]struct{}, item *yItem) bool {
+	_, ok := set[item]
+	return ok
+}
+
+func (d *Doc) deleteItem(item *yItem) {
+	if item.deleted || item.gc {
+		return
+	}
+	if item.countable() && item.parentSub == nil && item.parent != nil {
+		item.parent.length -= item.length
+	}
+	item.deleted = true
+	if d.txn != nil {
+		*d.txn = append(*d.txn, yDeleteRange{client: item.id.client, clock: item.id.clock, len: item.length})
+	}
+	if ct, ok := item.content.(*contentType); ok {
+		for child := ct.typ.start; child != nil; child = child.right {
+			d.deleteItem(child)
+		}
+		for _, child := range ct.typ.keys {
+			d.deleteItem(child)
+		}
+	}
+}
+
+// applyPendingDeletes applies delete ranges whose structs are known and keeps
+// the rest for later.
+func (d *Doc) applyPendingDeletes() {
+	var rest []yDeleteRange
+	for _, r := range d.pendingDs {
+		end := r.clock + r.len
+		state := d.state(r.client)
+		if state < end {
+			from := r.clock
+			if state > from {
+				from = state
+			}
+			rest = append(rest, yDeleteRange{client: r.client, clock: from, len: end - from})
+			end = state
+		}
+		if r.clock >= end {
+			continue
+		}
+		structs := d.structs[r.client]
+		i := findStructIndex(structs, r.clock)
+		if item := structs[i]; item.id.clock < r.clock && !item.gc && !item.deleted {
+			d.insertStruct(r.client, i+1, d.splitItem(item, r.clock-item.id.clock))
+			i++
+		}
+		for ; i < len(d.structs[r.client]); i++ {
+			item := d.structs[r.client][i]
+			if item.id.clock >= end {
+				break
+			}
+			if item.deleted || item.gc {
+				continue
+			}
+			if end < item.id.clock+item.length {
+				d.insertStruct(r.client, i+1, d.splitItem(item, end-item.id.clock))
+			}
+			d.deleteItem(item)
+		}
+	}
+	d.pendingDs = rest
+}
+
+// decodeUpdate reads the structs and the delete set of a Yjs v1 update.
+func decodeUpdate(update []byte) ([]*yItem, []yDeleteRange, error) {
+	dec := newYDecoder(update)
+	numClients, err := dec.readVarUint()
+	if err != nil {
+		return nil, nil, err
+	}
+	var structs []*yItem
+	for i := uint64(0); i < numClients; i++ {
+		numStructs, err := dec.readVarUint()
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := dec.readVarUint()
+		if err != nil {
+			return nil, nil, err
+		}
+		clock, err := dec.readVarUint()
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := uint64(0); j < numStructs; j++ {
+			item, err := decodeStruct(dec, yID{client: client, clock: clock})
+			if err != nil {
+				return nil, nil, err
+			}
+			if item.length == 0 {
+				return nil, nil, errors.New("empty struct in Yjs update")
+			}
+			clock += item.length
+			if item.content != nil || item.gc {
+				structs = append(structs, item)
+			}
+		}
+	}
+	ds, err := decodeDeleteSet(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return structs, ds, nil
+}
+
+func decodeStruct(dec *yDecoder, id yID) (*yItem, error) {
+	info, err := dec.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch info & 0x1f {
+	case yRefGC:
+		n, err := dec.readVarUint()
+		return &yItem{id: id, length: n, gc: true}, err
+	case yRefSkip:
+		n, err := dec.readVarUint()
+		// skipped ranges carry no struct, only advance the clock
+		return &yItem{id: id, length: n}, err
+	}
+
+	item := &yItem{id: id}
+	if info&0x80 != 0 {
+		origin, err := readYID(dec)
+		if err != nil {
+			return nil, err
+		}
+		item.origin = &origin
+	}
+	if info&0x40 != 0 {
+		rightOrigin, err := readYID(dec)
+		if err != nil {
+			return nil, err
+		}
+		item.rightOrigin = &rightOrigin
+	}
+	if info&(0x80|0x40) == 0 {
+		isRoot, err := dec.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if isRoot == 1 {
+			key, err := dec.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			item.parentRoot = &key
+		} else {
+			parentID, err := readYID(dec)
+			if err != nil {
+				return nil, err
+			}
+			item.parentID = &parentID
+		}
+		if info&0x20 != 0 {
+			sub, err := dec.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			item.parentSub = &sub
+		}
+	}
+	if item.content, err = readContent(dec, info&0x1f); err != nil {
+		return nil, err
+	}
+	item.length = item.content.len()
+	return item, nil
+}
+
+func readYID(dec *yDecoder) (yID, error) {
+	client, err := dec.readVarUint()
+	if err != nil {
+		return yID{}, err
+	}
+	clock, err := dec.readVarUint()
+	return yID{client: client, clock: clock}, err
+}
+
+func decodeDeleteSet(dec *yDecoder) ([]yDeleteRange, error) {
+	if dec.remaining() == 0 {
+		return nil, nil
+	}
+	numClients, err := dec.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	var ds []yDeleteRange
+	for i := uint64(0); i < numClients; i++ {
+		client, err := dec.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		numRanges, err := dec.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < numRanges; j++ {
+			clock, err := dec.readVarUint()
+			if err != nil {
+				return nil, err
+			}
+			n, err := dec.readVarUint()
+			if err != nil {
+				return nil, err
+			}
+			ds = append(ds, yDeleteRange{client: client, clock: clock, len: n})
+		}
+	}
+	return ds, nil
+}
+
+// EncodeStateVector encodes the state vector of the document, as sent in sync step 1.
+func (d *Doc) EncodeStateVector() []byte {
+	return encodeStateVector(d.stateVector())
+}
+
+func encodeStateVector(sv map[uint64]uint64) []byte {
+	clients := make([]uint64, 0, len(sv))
+	for client := range sv {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i] > clients[j] })
+	buf := &bytes.Buffer{}
+	writeUvarint(buf, uint64(len(clients)))
+	for _, client := range clients {
+		writeUvarint(buf, client)
+		writeUvarint(buf, sv[client])
+	}
+	return buf.Bytes()
+}
+
+// DecodeStateVector reads an encoded state vector.
+func decodeStateVector(bs []byte) (map[uint64]uint64, error) {
+	dec := newYDecoder(bs)
+	n, err := dec.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(dec.remaining()) {
+		return nil, errUnexpectedEOF
+	}
+	sv := make(map[uint64]uint64, n)
+	for i := uint64(0); i < n; i++ {
+		client, err := dec.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if sv[client], err = dec.readVarUint(); err != nil {
+			return nil, err
+		}
+	}
+	return sv, nil
+}
+
+// EncodeStateAsUpdate encodes everything the document knows beyond the given
+// encoded state vector as a single update. A nil state vector encodes the
+// whole document.
+func (d *Doc) EncodeStateAsUpdate(stateVector []byte) ([]byte, error) {
+	sv := map[uint64]uint64{}
+	if len(stateVector) > 0 {
+		var err error
+		if sv, err = decodeStateVector(stateVector); err != nil {
+			return nil, fmt.Errorf("invalid state vector: %w", err)
+		}
+	}
+	return d.encodeDiff(sv), nil
+}
+
+func (d *Doc) encodeDiff(sv map[uint64]uint64) []byte {
+	buf := &bytes.Buffer{}
+	d.writeStructsSince(buf, sv, d.pending)
+	writeDeleteSet(buf, append(d.deleteSet(), d.pendingDs...))
+	return buf.Bytes()
+}
+
+// writeStructsSince writes the structs the state vector sv doesn't cover,
+// followed by the given pending structs. As in Yjs, the clock gaps in front of
+// pending structs are written as skips, so that a receiver keeps them pending
+// until the missing structs arrive.
+func (d *Doc) writeStructsSince(buf *bytes.Buffer, sv map[uint64]uint64, pending []*yItem) {
+	type run struct {
+		item   *yItem
+		offset uint64
+		skip   uint64
+	}
+	byClient := make(map[uint64][]*yItem)
+	for _, item := range pending {
+		byClient[item.id.client] = append(byClient[item.id.client], item)
+	}
+	var clients []uint64
+	for client := range d.structs {
+		if sv[client] < d.state(client) {
+			clients = append(clients, client)
+		}
+	}
+	for client := range byClient {
+		if _, ok := d.structs[client]; !ok || sv[client] >= d.state(client) {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i] > clients[j] })
+
+	var written []uint64
+	runs := make(map[uint64][]run)
+	starts := make(map[uint64]uint64)
+	for _, client := range clients {
+		var out []run
+		clock := sv[client]
+		if structs := d.structs[client]; clock < d.state(client) {
+			if first := structs[0].id.clock; clock < first {
+				clock = first
+			}
+			starts[client] = clock
+			start := findStructIndex(structs, clock)
+			out = append(out, run{item: structs[start], offset: clock - structs[start].id.clock})
+			for _, item := range structs[start+1:] {
+				out = append(out, run{item: item})
+			}
+			clock = d.state(client)
+		}
+		items := byClient[client]
+		sort.Slice(items, func(i, j int) bool { return items[i].id.clock < items[j].id.clock })
+		for _, item := range items {
+			end := item.id.clock + item.length
+			if end <= clock {
+				continue
+			}
+			switch {
+			case len(out) == 0:
+				clock = max(clock, item.id.clock)
+				starts[client] = clock
+			case item.id.clock > clock:
+				out = append(out, run{skip: item.id.clock - clock})
+				clock = item.id.clock
+			}
+			out = append(out, run{item: item, offset: clock - item.id.clock})
+			clock = end
+		}
+		if len(out) > 0 {
+			written = append(written, client)
+			runs[client] = out
+		}
+	}
+	writeUvarint(buf, uint64(len(written)))
+	for _, client := range written {
+		writeUvarint(buf, uint64(len(runs[client])))
+		writeUvarint(buf, client)
+		writeUvarint(buf, starts[client])
+		for _, r := range runs[client] {
+			if r.item == nil {
+				buf.WriteByte(yRefSkip)
+				writeUvarint(buf, r.skip)
+				continue
+			}
+			writeStruct(buf, r.item, r.offset)
+		}
+	}
+}
+
+func writeStruct(buf *bytes.Buffer, item *yItem, offset uint64) {
+	if item.gc {
+		buf.WriteByte(yRefGC)
+		writeUvarint(buf, item.length-offset)
+		return
+	}
+	origin := item.origin
+	if offset > 0 {
+		origin = &yID{client: item.id.client, clock: item.id.clock + offset - 1}
+	}
+	info := item.content.ref() & 0x1f
+	if origin != nil {
+		info |= 0x80
+	}
+	if item.rightOrigin != nil {
+		info |= 0x40
+	}
+	if item.parentSub != nil {
+		info |= 0x20
+	}
+	buf.WriteByte(info)
+	if origin != nil {
+		writeUvarint(buf, origin.client)
+		writeUvarint(buf, origin.clock)
+	}
+	if item.rightOrigin != nil {
+		writeUvarint(buf, item.rightOrigin.client)
+		writeUvarint(buf, item.rightOrigin.clock)
+	}
+	if origin == nil && item.rightOrigin == nil {
+		switch {
+		case item.parent != nil && item.parent.item == nil:
+			writeUvarint(buf, 1)
+			writeVarString(buf, item.parent.name)
+		case item.parent != nil:
+			writeUvarint(buf, 0)
+			writeUvarint(buf, item.parent.item.id.client)
+			writeUvarint(buf, item.parent.item.id.clock)
+		case item.parentRoot != nil:
+			writeUvarint(buf, 1)
+			writeVarString(buf, *item.parentRoot)
+		case item.parentID != nil:
+			writeUvarint(buf, 0)
+			writeUvarint(buf, item.parentID.client)
+			writeUvarint(buf, item.parentID.clock)
+		}
+		if item.parentSub != nil {
+			writeVarString(buf, *item.parentSub)
+		}
+	}
+	item.content.write(buf, offset)
+}
+
+// deleteSet collects the deleted ranges of all known structs.
+func (d *Doc) deleteSet() []yDeleteRange {
+	var ds []yDeleteRange
+	for client, structs := range d.structs {
+		for _, item := range structs {
+			if !item.deleted && !item.gc {
+				continue
+			}
+			if n := len(ds); n > 0 && ds[n-1].client == client && ds[n-1].clock+ds[n-1].len == item.id.clock {
+				ds[n-1].len += item.length
+			} else {
+				ds = append(ds, yDeleteRange{client: client, clock: item.id.clock, len: item.length})
+			}
+		}
+	}
+	return ds
+}
+
+func writeDeleteSet(buf *bytes.Buffer, ds []yDeleteRange) {
+	byClient := make(map[uint64][]yDeleteRange)
+	var clients []uint64
+	for _, r := range ds {
+		if _, ok := byClient[r.client]; !ok {
+			clients = append(clients, r.client)
+		}
+		byClient[r.client] = append(byClient[r.client], r)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i] > clients[j] })
+	writeUvarint(buf, uint64(len(clients)))
+	for _, client := range clients {
+		ranges := byClient[client]
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].clock < ranges[j].clock })
+		merged := ranges[:1]
+		for _, r := range ranges[1:] {
+			last := &merged[len(merged)-1]
+			if r.clock <= last.clock+last.len {
+				last.len = max(last.len, r.clock+r.len-last.clock)
+			} else {
+				merged = append(merged, r)
+			}
+		}
+		ranges = merged
+		writeUvarint(buf, client)
+		writeUvarint(buf, uint64(len(ranges)))
+		for _, r := range ranges {
+			writeUvarint(buf, r.clock)
+			writeUvarint(buf, r.len)
+		}
+	}
+}
+
+// MergeUpdates combines several Yjs updates into one.
+func MergeUpdates(updates ...[]byte) ([]byte, error) {
+	doc := NewDoc()
+	for _, u := range updates {
+		if err := doc.ApplyUpdate(u); err != nil {
+			return nil, err
+		}
+	}
+	return doc.EncodeStateAsUpdate(nil)
+}
@@ -0,0 +1,309 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"unicode/utf16"
+)
+
+var errUnexpectedEOF = errors.New("unexpected end of Yjs update")
+
+// yDecoder reads the lib0 encoding used by Yjs updates.
+type yDecoder struct {
+	buf []byte
+	pos int
+}
+
+func newYDecoder(buf []byte) *yDecoder {
+	return &yDecoder{buf: buf}
+}
+
+func (d *yDecoder) remaining() int {
+	return len(d.buf) - d.pos
+}
+
+func (d *yDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errUnexpectedEOF
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *yDecoder) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(d.remaining()) {
+		return nil, errUnexpectedEOF
+	}
+	bs := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return bs, nil
+}
+
+func (d *yDecoder) readVarUint() (uint64, error) {
+	n, size := binary.Uvarint(d.buf[d.pos:])
+	if size <= 0 {
+		return 0, errUnexpectedEOF
+	}
+	d.pos += size
+	return n, nil
+}
+
+// readVarInt reads a lib0 signed varint: the first byte carries a continuation
+// bit, a sign bit and 6 bits of the number.
+func (d *yDecoder) readVarInt() (int64, error) {
+	r, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	num := uint64(r & 0x3f)
+	negative := r&0x40 != 0
+	shift := uint(6)
+	for r&0x80 != 0 {
+		if r, err = d.readByte(); err != nil {
+			return 0, err
+		}
+		num |= uint64(r&0x7f) << shift
+		shift += 7
+		if shift > 63 {
+			return 0, errors.New("varint overflows int64")
+		}
+	}
+	if negative {
+		return -int64(num), nil
+	}
+	return int64(num), nil
+}
+
+func (d *yDecoder) readVarBytes() ([]byte, error) {
+	n, err := d.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(n)
+}
+
+func (d *yDecoder) readVarString() (string, error) {
+	bs, err := d.readVarBytes()
+	return string(bs), err
+}
+
+// yUndefined is the decoded form of JavaScript's undefined.
+type yUndefined struct{}
+
+// yBigInt is a value that was encoded as a JavaScript BigInt.
+type yBigInt int64
+
+// maxAnyDepth bounds the nesting of objects and arrays in readAny, which
+// recurses for every level.
+const maxAnyDepth = 1000
+
+// readAny reads a value written by lib0's writeAny.
+func (d *yDecoder) readAny() (any, error) {
+	return d.readAnyDepth(0)
+}
+
+func (d *yDecoder) readAnyDepth(depth int) (any, error) {
+	if depth > maxAnyDepth {
+		return nil, errors.New("value nested too deeply in Yjs update")
+	}
+	t, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case 127:
+		return yUndefined{}, nil
+	case 126:
+		return nil, nil
+	case 125:
+		n, err := d.readVarInt()
+		return float64(n), err
+	case 124:
+		bs, err := d.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(bs))), nil
+	case 123:
+		bs, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(bs)), nil
+	case 122:
+		bs, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return yBigInt(binary.BigEndian.Uint64(bs)), nil
+	case 121:
+		return false, nil
+	case 120:
+		return true, nil
+	case 119:
+		return d.readVarString()
+	case 118:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		// Every entry takes at least a byte
+		if n > uint64(d.remaining()) {
+			return nil, errUnexpectedEOF
+		}
+		obj := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.readVarString()
+			if err != nil {
+				return nil, err
+			}
+			if obj[key], err = d.readAnyDepth(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case 117:
+		n, err := d.readVarUint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(d.remaining()) {
+			return nil, errUnexpectedEOF
+		}
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = d.readAnyDepth(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case 116:
+		bs, err := d.readVarBytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), bs...), nil
+	}
+	return nil, errors.New("unknown any type in Yjs update")
+}
+
+func writeVarInt(buf *bytes.Buffer, n int64) {
+	negative := n < 0
+	num := uint64(n)
+	if negative {
+		num = uint64(-n)
+	}
+	b := byte(num & 0x3f)
+	if negative {
+		b |= 0x40
+	}
+	num >>= 6
+	if num > 0 {
+		b |= 0x80
+	}
+	buf.WriteByte(b)
+	for num > 0 {
+		b = byte(num & 0x7f)
+		num >>= 7
+		if num > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+	}
+}
+
+func writeVarBytes(buf *bytes.Buffer, bs []byte) {
+	writeUvarint(buf, uint64(len(bs)))
+	buf.Write(bs)
+}
+
+func writeVarString(buf *bytes.Buffer, s string) {
+	writeVarBytes(buf, []byte(s))
+}
+
+// writeAny mirrors lib0's writeAny, including its choice of number encoding.
+func writeAny(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case yUndefined:
+		buf.WriteByte(127)
+	case nil:
+		buf.WriteByte(126)
+	case bool:
+		if v {
+			buf.WriteByte(120)
+		} else {
+			buf.WriteByte(121)
+		}
+	case int:
+		writeAnyNumber(buf, float64(v))
+	case int64:
+		writeAnyNumber(buf, float64(v))
+	case float32:
+		writeAnyNumber(buf, float64(v))
+	case float64:
+		writeAnyNumber(buf, v)
+	case yBigInt:
+		buf.WriteByte(122)
+		var bs [8]byte
+		binary.BigEndian.PutUint64(bs[:], uint64(v))
+		buf.Write(bs[:])
+	case string:
+		buf.WriteByte(119)
+		writeVarString(buf, v)
+	case []byte:
+		buf.WriteByte(116)
+		writeVarBytes(buf, v)
+	case []any:
+		buf.WriteByte(117)
+		writeUvarint(buf, uint64(len(v)))
+		for _, e := range v {
+			writeAny(buf, e)
+		}
+	case map[string]any:
+		buf.WriteByte(118)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeUvarint(buf, uint64(len(keys)))
+		for _, k := range keys {
+			writeVarString(buf, k)
+			writeAny(buf, v[k])
+		}
+	default:
+		buf.WriteByte(127)
+	}
+}
+
+func writeAnyNumber(buf *bytes.Buffer, f float64) {
+	switch {
+	case f == math.Trunc(f) && math.Abs(f) <= math.MaxInt32:
+		buf.WriteByte(125)
+		writeVarInt(buf, int64(f))
+	case float64(float32(f)) == f:
+		buf.WriteByte(124)
+		var bs [4]byte
+		binary.BigEndian.PutUint32(bs[:], math.Float32bits(float32(f)))
+		buf.Write(bs[:])
+	default:
+		buf.WriteByte(123)
+		var bs [8]byte
+		binary.BigEndian.PutUint64(bs[:], math.Float64bits(f))
+		buf.Write(bs[:])
+	}
+}
+
+// Yjs measures strings in UTF-16 code units, so string content is kept in that form.
+
+func toUTF16(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+func fromUTF16(units []uint16) string {
+	return string(utf16.Decode(units))
+}
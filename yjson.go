@@ -0,0 +1,277 @@
+package ydb
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToJSON renders the top-level shared types of the document like Yjs's
+// toJSON: Y.Map becomes an object, Y.Array an array, Y.Text its string
+// content and Y.XmlFragment its XML serialization. Binary content is a
+// []byte, which encoding/json renders as base64, and subdocuments are objects
+// holding their guid.
+//
+// Updates don't record which type a top-level name was created as, so it is
+// inferred from the content. Roots whose content tells nothing, e.g. because
+// it was deleted and garbage collected, render as nil.
+func (d *Doc) ToJSON() map[string]any {
+	out := make(map[string]any, len(d.share))
+	for name, t := range d.share {
+		ref := t.ref
+		if ref == yUnknownRef {
+			ref = inferRootRef(t)
+		}
+		if ref == yUnknownRef {
+			out[name] = nil
+			continue
+		}
+		out[name] = t.toJSON(ref)
+	}
+	return out
+}
+
+// writeJSON encodes v without escaping <, > and &, which XML content is full of.
+func writeJSON(w io.Writer, v any, indent string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	return enc.Encode(v)
+}
+
+// inferRootRef guesses the type of a root from the content of its items.
+func inferRootRef(t *yType) int {
+	for item := t.start; item != nil; item = item.right {
+		switch c := item.content.(type) {
+		case *contentString, *contentFormat, *contentEmbed:
+			return yTextRef
+		case *contentType:
+			switch c.typ.ref {
+			case yXmlElementRef, yXmlTextRef, yXmlHookRef:
+				return yXmlFragmentRef
+			}
+			return yArrayRef
+		case *contentAny, *contentJSON, *contentBinary, *contentDoc:
+			return yArrayRef
+		}
+	}
+	if len(t.keys) > 0 {
+		return yMapRef
+	}
+	return yUnknownRef
+}
+
+func (t *yType) toJSON(ref int) any {
+	switch ref {
+	case yMapRef, yXmlHookRef:
+		obj := make(map[string]any, len(t.keys))
+		for key, item := range t.keys {
+			if v, ok := mapValue(item); ok {
+				obj[key] = v
+			}
+		}
+		return obj
+	case yArrayRef:
+		arr := []any{}
+		for item := t.start; item != nil; item = item.right {
+			if !item.deleted && item.countable() {
+				arr = append(arr, contentValues(item.content)...)
+			}
+		}
+		return arr
+	case yTextRef:
+		var units []uint16
+		for item := t.start; item != nil; item = item.right {
+			if s, ok := item.content.(*contentString); ok && !item.deleted {
+				units = append(units, s.units...)
+			}
+		}
+		return fromUTF16(units)
+	}
+	sb := &strings.Builder{}
+	t.writeXML(sb)
+	return sb.String()
+}
+
+// mapValue returns the current value of a map entry.
+func mapValue(item *yItem) (any, bool) {
+	if item.deleted || item.gc {
+		return nil, false
+	}
+	values := contentValues(item.content)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[len(values)-1], true
+}
+
+// contentValues returns the JSON values of an item's content.
+func contentValues(c yContent) []any {
+	switch c := c.(type) {
+	case *contentAny:
+		values := make([]any, len(c.values))
+		for i, v := range c.values {
+			values[i] = jsonValue(v)
+		}
+		return values
+	case *contentJSON:
+		values := make([]any, len(c.values))
+		for i, s := range c.values {
+			json.Unmarshal([]byte(s), &values[i])
+		}
+		return values
+	case *contentString:
+		values := make([]any, len(c.units))
+		for i := range c.units {
+			values[i] = fromUTF16(c.units[i : i+1])
+		}
+		return values
+	case *contentBinary:
+		return []any{c.data}
+	case *contentEmbed:
+		var v any
+		json.Unmarshal([]byte(c.json), &v)
+		return []any{v}
+	case *contentType:
+		return []any{c.typ.toJSON(c.typ.ref)}
+	case *contentDoc:
+		return []any{map[string]any{"guid": c.guid}}
+	}
+	return nil
+}
+
+// jsonValue maps values decoded by readAny onto what encoding/json can
+// marshal, following JSON.stringify for undefined, NaN and infinities.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case yUndefined:
+		return nil
+	case yBigInt:
+		return int64(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for key, value := range v {
+			obj[key] = jsonValue(value)
+		}
+		return obj
+	case []any:
+		arr := make([]any, len(v))
+		for i, value := range v {
+			arr[i] = jsonValue(value)
+		}
+		return arr
+	}
+	return v
+}
+
+// writeXML serializes an XML type like Yjs's toString.
+func (t *yType) writeXML(sb *strings.Builder) {
+	switch t.ref {
+	case yXmlTextRef:
+		t.writeXMLText(sb)
+		return
+	case yXmlHookRef:
+		return
+	}
+	var name string
+	if t.ref == yXmlElementRef {
+		name = strings.ToLower(t.name)
+		attrs := make(map[string]any, len(t.keys))
+		for key, item := range t.keys {
+			if v, ok := mapValue(item); ok {
+				attrs[key] = v
+			}
+		}
+		sb.WriteString("<" + name)
+		writeXMLAttributes(sb, attrs)
+		sb.WriteString(">")
+	}
+	for item := t.start; item != nil; item = item.right {
+		if c, ok := item.content.(*contentType); ok && !item.deleted {
+			c.typ.writeXML(sb)
+		}
+	}
+	if t.ref == yXmlElementRef {
+		sb.WriteString("</" + name + ">")
+	}
+}
+
+// writeXMLText renders formatted text runs as nested elements, e.g. a run
+// with the attribute bold becomes <bold>text</bold>.
+func (t *yType) writeXMLText(sb *strings.Builder) {
+	attrs := map[string]any{}
+	var run []uint16
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sb.WriteString("<" + name)
+			if nested, ok := attrs[name].(map[string]any); ok {
+				writeXMLAttributes(sb, nested)
+			}
+			sb.WriteString(">")
+		}
+		sb.WriteString(fromUTF16(run))
+		for i := len(names) - 1; i >= 0; i-- {
+			sb.WriteString("</" + names[i] + ">")
+		}
+		run = nil
+	}
+	for item := t.start; item != nil; item = item.right {
+		if item.deleted {
+			continue
+		}
+		switch c := item.content.(type) {
+		case *contentString:
+			run = append(run, c.units...)
+		case *contentFormat:
+			flush()
+			var v any
+			json.Unmarshal([]byte(c.value), &v)
+			if v == nil {
+				delete(attrs, c.key)
+			} else {
+				attrs[c.key] = v
+			}
+		case *contentEmbed, *contentType:
+			flush()
+		}
+	}
+	flush()
+}
+
+// writeXMLAttributes writes ` key="value"` for each attribute, sorted by key.
+func writeXMLAttributes(sb *strings.Builder, attrs map[string]any) {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(" " + key + `="` + xmlAttributeValue(attrs[key]) + `"`)
+	}
+}
+
+func xmlAttributeValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
@@ -0,0 +1,112 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testJSONDoc builds updates for a map with a nested map, an array, a text
+// and an XML fragment holding <p class="x"><bold>bold</bold> plain</p>.
+func testJSONDoc() [][]byte {
+	one := func(it testItem) []byte { return testUpdate([]testItem{it}) }
+	return [][]byte{
+		one(testItem{client: 1, root: "map", key: "title", value: "Hello"}),
+		one(testItem{client: 1, clock: 1, root: "map", key: "count", value: float64(3)}),
+		one(testItem{client: 1, clock: 2, root: "map", key: "nested", content: &contentType{typ: &yType{ref: yMapRef}}}),
+		one(testItem{client: 1, clock: 3, parent: &yID{1, 2}, key: "ok", value: true}),
+		one(testItem{client: 1, clock: 4, root: "map", key: "gone", value: "x"}),
+		one(testItem{client: 2, root: "list", value: "x"}),
+		one(testItem{client: 2, clock: 1, origin: &yID{2, 0}, value: math.NaN()}),
+		one(testItem{client: 2, clock: 2, origin: &yID{2, 1}, content: &contentBinary{data: []byte{1, 2}}}),
+		one(testItem{client: 3, root: "text", text: "hi"}),
+		one(testItem{client: 3, clock: 2, origin: &yID{3, 1}, text: "!"}),
+		one(testItem{client: 4, root: "xml", content: &contentType{typ: &yType{ref: yXmlElementRef, name: "P"}}}),
+		one(testItem{client: 4, clock: 1, parent: &yID{4, 0}, key: "class", value: "x"}),
+		one(testItem{client: 4, clock: 2, parent: &yID{4, 0}, content: &contentType{typ: &yType{ref: yXmlTextRef}}}),
+		one(testItem{client: 4, clock: 3, parent: &yID{4, 2}, content: &contentFormat{key: "bold", value: "true"}}),
+		one(testItem{client: 4, clock: 4, origin: &yID{4, 3}, text: "bold"}),
+		one(testItem{client: 4, clock: 8, origin: &yID{4, 7}, content: &contentFormat{key: "bold", value: "null"}}),
+		one(testItem{client: 4, clock: 9, origin: &yID{4, 8}, text: " plain"}),
+		// delete map.gone
+		testUpdate(nil, yDeleteRange{client: 1, clock: 4, len: 1}),
+	}
+}
+
+func TestDocToJSON(t *testing.T) {
+	doc := applyAll(t, testJSONDoc()...)
+	got := &bytes.Buffer{}
+	if err := writeJSON(got, doc.ToJSON(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"list":["x",null,"AQI="],"map":{"count":3,"nested":{"ok":true},"title":"Hello"},"text":"hi!","xml":"<p class=\"x\"><bold>bold</bold> plain</p>"}` + "\n"
+	if got.String() != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestDocToJSONUnknownRoot(t *testing.T) {
+	doc := applyAll(t,
+		testUpdate([]testItem{{client: 1, root: "empty", value: "x"}}, yDeleteRange{client: 1, clock: 0, len: 1}))
+	if got := doc.ToJSON(); !reflect.DeepEqual(got, map[string]any{"empty": []any{}}) {
+		t.Fatalf("deleted array content should still be an array, got %v", got)
+	}
+	doc = applyAll(t, testUpdate([]testItem{{client: 1, root: "gc", content: &contentDeleted{n: 1}}}))
+	if got := doc.ToJSON(); !reflect.DeepEqual(got, map[string]any{"gc": nil}) {
+		t.Fatalf("expected nil for a root without content, got %v", got)
+	}
+}
+
+func TestRoomJSONEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestServerWithComponents(t, NewDiskStore(dir), NewLocalBroadcaster(64), DefaultConfig())
+	for _, update := range testJSONDoc() {
+		if err := ts.ydb.AppendUpdate("room", update); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantBuf := &bytes.Buffer{}
+	writeJSON(wantBuf, applyAll(t, testJSONDoc()...).ToJSON(), "")
+	want := wantBuf.String()
+
+	roomJSON, err := ts.ydb.RoomJSON("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roomJSON, applyAll(t, testJSONDoc()...).ToJSON()) {
+		t.Fatalf("RoomJSON = %v", roomJSON)
+	}
+
+	resp, err := http.Get(ts.httpServer.URL + "/rest/room?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" || string(body) != want {
+		t.Fatalf("GET ?format=json = %s (%s)", body, resp.Header.Get("Content-Type"))
+	}
+
+	out := filepath.Join(t.TempDir(), "room.json")
+	if err := runCliCommand(ts.ydb, "export", "room", out, cliOptions{format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := os.ReadFile(out)
+	var v any
+	if err := json.Unmarshal(exported, &v); err != nil {
+		t.Fatal(err)
+	}
+	got := &bytes.Buffer{}
+	if writeJSON(got, v, ""); got.String() != want {
+		t.Fatalf("cli export = %s", exported)
+	}
+	if err := runCliCommand(ts.ydb, "export", "room", out, cliOptions{format: "xml"}); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
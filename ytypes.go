@@ -0,0 +1,402 @@
+package ydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+)
+
+// ErrIndexOutOfRange is returned for positions beyond the length of a Y.Array or Y.Text.
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// YMap is a Y.Map of a Doc.
+type YMap struct{ t *yType }
+
+// YArray is a Y.Array of a Doc.
+type YArray struct{ t *yType }
+
+// YText is a Y.Text of a Doc. Positions and lengths count UTF-16 code units,
+// as in Yjs.
+type YText struct{ t *yType }
+
+// GetMap returns the top-level Y.Map name, creating it if needed.
+func (d *Doc) GetMap(name string) *YMap { return &YMap{d.rootOf(name, yMapRef)} }
+
+// GetArray returns the top-level Y.Array name, creating it if needed.
+func (d *Doc) GetArray(name string) *YArray { return &YArray{d.rootOf(name, yArrayRef)} }
+
+// GetText returns the top-level Y.Text name, creating it if needed.
+func (d *Doc) GetText(name string) *YText { return &YText{d.rootOf(name, yTextRef)} }
+
+func (d *Doc) rootOf(name string, ref int) *yType {
+	t := d.root(name)
+	if t.ref == yUnknownRef {
+		t.ref = ref
+	}
+	return t
+}
+
+// Transact runs fn, which edits the document through its YMap, YArray and
+// YText handles, and returns the changes as a Yjs update, or nil if there were
+// none. Edits are made with the client ID of the document, a random one
+// unless set before.
+func (d *Doc) Transact(fn func() error) ([]byte, error) {
+	before := d.stateVector()
+	var deletes []yDeleteRange
+	d.txn = &deletes
+	err := fn()
+	d.txn = nil
+	if err != nil {
+		return nil, err
+	}
+	changed := len(deletes) > 0
+	for client, clock := range d.stateVector() {
+		changed = changed || clock > before[client]
+	}
+	if !changed {
+		return nil, nil
+	}
+	buf := &bytes.Buffer{}
+	d.writeStructsSince(buf, before, nil)
+	writeDeleteSet(buf, deletes)
+	return buf.Bytes(), nil
+}
+
+// localClient returns the client ID for local edits.
+func (d *Doc) localClient() uint64 {
+	for d.clientID == 0 {
+		// Yjs client IDs are random 32 bit numbers; don't reuse one of the document
+		if id := uint64(rand.Uint32()); len(d.structs[id]) == 0 {
+			d.clientID = id
+		}
+	}
+	return d.clientID
+}
+
+// insertLocal creates an item between left and the item after it, or as the
+// new value of key if key is not nil.
+func (d *Doc) insertLocal(parent *yType, left *yItem, key *string, content yContent) *yItem {
+	client := d.localClient()
+	item := &yItem{
+		id:        yID{client: client, clock: d.state(client)},
+		length:    content.len(),
+		left:      left,
+		parent:    parent,
+		parentSub: key,
+		content:   content,
+	}
+	if key != nil {
+		item.left = parent.mapItems()[*key]
+	} else if left != nil {
+		item.right = left.right
+	} else {
+		item.right = parent.start
+	}
+	if item.left != nil {
+		last := item.left.lastID()
+		item.origin = &last
+	}
+	if item.right != nil {
+		id := item.right.id
+		item.rightOrigin = &id
+	}
+	d.integrateItem(item)
+	return item
+}
+
+// itemAt returns the item after which index is, splitting an item if index
+// falls inside it.
+func (t *yType) itemAt(index uint64) (*yItem, error) {
+	if index > t.length {
+		return nil, ErrIndexOutOfRange
+	}
+	var left *yItem
+	for item := t.start; item != nil && index > 0; item = item.right {
+		if !item.deleted && item.countable() {
+			if index < item.length {
+				return t.doc.itemCleanEnd(yID{client: item.id.client, clock: item.id.clock + index - 1}), nil
+			}
+			index -= item.length
+		}
+		left = item
+	}
+	return left, nil
+}
+
+// deleteRange deletes length countable units starting at index.
+func (t *yType) deleteRange(index, length uint64) error {
+	if index+length > t.length {
+		return ErrIndexOutOfRange
+	}
+	for item := t.start; item != nil && length > 0; item = item.right {
+		if item.deleted || !item.countable() {
+			continue
+		}
+		if index >= item.length {
+			index -= item.length
+			continue
+		}
+		if index > 0 {
+			item = t.doc.itemCleanStart(yID{client: item.id.client, clock: item.id.clock + index})
+			index = 0
+		}
+		if length < item.length {
+			t.doc.itemCleanStart(yID{client: item.id.client, clock: item.id.clock + length})
+		}
+		length -= item.length
+		t.doc.deleteItem(item)
+	}
+	return nil
+}
+
+// insertValues inserts values after left, grouping plain values into one
+// item like Yjs does. Binary values get items of their own.
+func (t *yType) insertValues(left *yItem, values []any) error {
+	var plain []any
+	flush := func() {
+		if len(plain) > 0 {
+			left = t.doc.insertLocal(t, left, nil, &contentAny{values: plain})
+			plain = nil
+		}
+	}
+	for _, v := range values {
+		if bs, ok := v.([]byte); ok {
+			flush()
+			left = t.doc.insertLocal(t, left, nil, &contentBinary{data: bs})
+			continue
+		}
+		v, err := anyValue(v)
+		if err != nil {
+			return err
+		}
+		plain = append(plain, v)
+	}
+	flush()
+	return nil
+}
+
+// anyValue converts v into a value writeAny can encode, with numbers as
+// float64 like decoded ones. Types other than JSON-like values go through
+// encoding/json.
+func anyValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, float64, []byte:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case []any:
+		arr := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if arr[i], err = anyValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for key, e := range v {
+			var err error
+			if obj[key], err = anyValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+	if rv := reflect.ValueOf(v); rv.CanInt() {
+		return float64(rv.Int()), nil
+	} else if rv.CanUint() {
+		return float64(rv.Uint()), nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %T: %w", v, err)
+	}
+	var out any
+	err = json.Unmarshal(bs, &out)
+	return out, err
+}
+
+// sharedValue returns the value of a content unit, with nested types as handles.
+func sharedValue(c yContent, i int) any {
+	if ct, ok := c.(*contentType); ok {
+		switch ct.typ.ref {
+		case yMapRef:
+			return &YMap{ct.typ}
+		case yArrayRef:
+			return &YArray{ct.typ}
+		case yTextRef:
+			return &YText{ct.typ}
+		}
+	}
+	return contentValues(c)[i]
+}
+
+// Get returns the value of key. Nested types are returned as *YMap, *YArray
+// or *YText.
+func (m *YMap) Get(key string) (any, bool) {
+	item := m.t.keys[key]
+	if item == nil || item.deleted || item.gc {
+		return nil, false
+	}
+	return sharedValue(item.content, int(item.length)-1), true
+}
+
+// Keys returns the keys that currently have a value, in no particular order.
+func (m *YMap) Keys() []string {
+	var keys []string
+	for key, item := range m.t.keys {
+		if !item.deleted && !item.gc {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Set sets key to a JSON-like value or a []byte.
+func (m *YMap) Set(key string, value any) error {
+	var content yContent
+	if bs, ok := value.([]byte); ok {
+		content = &contentBinary{data: bs}
+	} else {
+		v, err := anyValue(value)
+		if err != nil {
+			return err
+		}
+		content = &contentAny{values: []any{v}}
+	}
+	m.t.doc.insertLocal(m.t, nil, &key, content)
+	return nil
+}
+
+// SetMap sets key to a new, empty Y.Map and returns it.
+func (m *YMap) SetMap(key string) *YMap { return &YMap{m.setType(key, yMapRef)} }
+
+// SetArray sets key to a new, empty Y.Array and returns it.
+func (m *YMap) SetArray(key string) *YArray { return &YArray{m.setType(key, yArrayRef)} }
+
+// SetText sets key to a new, empty Y.Text and returns it.
+func (m *YMap) SetText(key string) *YText { return &YText{m.setType(key, yTextRef)} }
+
+func (m *YMap) setType(key string, ref int) *yType {
+	t := &yType{ref: ref}
+	m.t.doc.insertLocal(m.t, nil, &key, &contentType{typ: t})
+	return t
+}
+
+// Delete removes key.
+func (m *YMap) Delete(key string) {
+	if item := m.t.keys[key]; item != nil {
+		m.t.doc.deleteItem(item)
+	}
+}
+
+// Len returns the number of elements.
+func (a *YArray) Len() int { return int(a.t.length) }
+
+// Get returns the element at index. Nested types are returned as *YMap,
+// *YArray or *YText.
+func (a *YArray) Get(index int) (any, error) {
+	if index < 0 || index >= a.Len() {
+		return nil, ErrIndexOutOfRange
+	}
+	for item := a.t.start; item != nil; item = item.right {
+		if item.deleted || !item.countable() {
+			continue
+		}
+		if index < int(item.length) {
+			return sharedValue(item.content, index), nil
+		}
+		index -= int(item.length)
+	}
+	return nil, ErrIndexOutOfRange
+}
+
+// Insert inserts JSON-like values or []byte at index.
+func (a *YArray) Insert(index int, values ...any) error {
+	if index < 0 {
+		return ErrIndexOutOfRange
+	}
+	left, err := a.t.itemAt(uint64(index))
+	if err != nil {
+		return err
+	}
+	return a.t.insertValues(left, values)
+}
+
+// Push appends values.
+func (a *YArray) Push(values ...any) error {
+	return a.Insert(a.Len(), values...)
+}
+
+// InsertMap inserts a new, empty Y.Map at index and returns it.
+func (a *YArray) InsertMap(index int) (*YMap, error) {
+	t, err := a.insertType(index, yMapRef)
+	return &YMap{t}, err
+}
+
+// InsertArray inserts a new, empty Y.Array at index and returns it.
+func (a *YArray) InsertArray(index int) (*YArray, error) {
+	t, err := a.insertType(index, yArrayRef)
+	return &YArray{t}, err
+}
+
+// InsertText inserts a new, empty Y.Text at index and returns it.
+func (a *YArray) InsertText(index int) (*YText, error) {
+	t, err := a.insertType(index, yTextRef)
+	return &YText{t}, err
+}
+
+func (a *YArray) insertType(index, ref int) (*yType, error) {
+	if index < 0 {
+		return nil, ErrIndexOutOfRange
+	}
+	left, err := a.t.itemAt(uint64(index))
+	if err != nil {
+		return nil, err
+	}
+	t := &yType{ref: ref}
+	a.t.doc.insertLocal(a.t, left, nil, &contentType{typ: t})
+	return t, nil
+}
+
+// Delete removes length elements starting at index.
+func (a *YArray) Delete(index, length int) error {
+	if index < 0 || length < 0 {
+		return ErrIndexOutOfRange
+	}
+	return a.t.deleteRange(uint64(index), uint64(length))
+}
+
+// Len returns the length in UTF-16 code units.
+func (t *YText) Len() int { return int(t.t.length) }
+
+// String returns the text without formatting.
+func (t *YText) String() string { return t.t.toJSON(yTextRef).(string) }
+
+// Insert inserts s at index.
+func (t *YText) Insert(index int, s string) error {
+	if index < 0 {
+		return ErrIndexOutOfRange
+	}
+	if s == "" {
+		return nil
+	}
+	left, err := t.t.itemAt(uint64(index))
+	if err != nil {
+		return err
+	}
+	t.t.doc.insertLocal(t.t, left, nil, &contentString{units: toUTF16(s)})
+	return nil
+}
+
+// Delete removes length code units starting at index.
+func (t *YText) Delete(index, length int) error {
+	if index < 0 || length < 0 {
+		return ErrIndexOutOfRange
+	}
+	return t.t.deleteRange(uint64(index), uint64(length))
+}
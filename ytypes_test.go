@@ -0,0 +1,131 @@
+package ydb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDocTransactMatchesYjs(t *testing.T) {
+	doc := NewDoc()
+	doc.clientID = 1
+	update, err := doc.Transact(func() error { return doc.GetText("text").Insert(0, "abc") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{1, 1, 1, 0, 4, 1, 4, 't', 'e', 'x', 't', 3, 'a', 'b', 'c', 0}
+	if !bytes.Equal(update, want) {
+		t.Fatalf("update %v, want %v", update, want)
+	}
+}
+
+func TestDocEdit(t *testing.T) {
+	doc := NewDoc()
+	replica := NewDoc()
+	edit := func(fn func() error) {
+		t.Helper()
+		update, err := doc.Transact(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := replica.ApplyUpdate(update); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := replica.ToJSON(), doc.ToJSON(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("replica %v, want %v", got, want)
+		}
+	}
+
+	edit(func() error {
+		m := doc.GetMap("meta")
+		m.Set("title", "Notes")
+		m.Set("count", 2)
+		m.SetMap("owner").Set("name", "bot")
+		list := doc.GetArray("list")
+		list.Push(1, "b", []byte{7})
+		list.Insert(1, "a")
+		text := doc.GetText("text")
+		text.Insert(0, "hello world")
+		return text.Insert(5, ",")
+	})
+	edit(func() error {
+		m := doc.GetMap("meta")
+		m.Set("title", "Renamed")
+		m.Delete("count")
+		doc.GetArray("list").Delete(0, 2)
+		return doc.GetText("text").Delete(0, 7)
+	})
+
+	want := map[string]any{
+		"meta": map[string]any{"title": "Renamed", "owner": map[string]any{"name": "bot"}},
+		"list": []any{"b", []byte{7}},
+		"text": "world",
+	}
+	if got := replica.ToJSON(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	owner, _ := doc.GetMap("meta").Get("owner")
+	if name, _ := owner.(*YMap).Get("name"); name != "bot" {
+		t.Fatalf("nested map value %v", name)
+	}
+	if v, err := doc.GetArray("list").Get(0); err != nil || v != "b" {
+		t.Fatalf("list[0] = %v (%v)", v, err)
+	}
+
+	if err := doc.GetText("text").Insert(6, "x"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange, got %v", err)
+	}
+	if err := doc.GetArray("list").Delete(1, 2); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange, got %v", err)
+	}
+	if update, err := doc.Transact(func() error { return nil }); update != nil || err != nil {
+		t.Fatalf("expected no update without changes, got %v (%v)", update, err)
+	}
+}
+
+func TestYdbEdit(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.dial(t, "room")
+	client.sendSyncStep1([]byte{0})
+	client.recvAll(200 * time.Millisecond)
+
+	err := ts.ydb.Edit("room", func(doc *Doc) error {
+		return doc.GetArray("paragraphs").Push("first")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ts.ydb.Edit("room", func(doc *Doc) error {
+		return doc.GetArray("paragraphs").Push("second")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := client.recvAll(500 * time.Millisecond); len(msgs) != 2 {
+		t.Fatalf("expected both edits to be broadcast, got %d messages", len(msgs))
+	}
+	content, err := ts.ydb.RoomJSON("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"first", "second"}; !reflect.DeepEqual(content["paragraphs"], want) {
+		t.Fatalf("paragraphs = %v", content["paragraphs"])
+	}
+
+	size, _ := ts.store.Size("room")
+	failed := errors.New("failed")
+	if err := ts.ydb.Edit("room", func(doc *Doc) error {
+		doc.GetArray("paragraphs").Push("third")
+		return failed
+	}); err != failed {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	if err := ts.ydb.Edit("room", func(doc *Doc) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := ts.store.Size("room"); after != size {
+		t.Fatal("failed or empty edits must not write to the room")
+	}
+}